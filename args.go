@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tests may give the solution command line arguments, which follow the
+// kind's own command, and environment variables, which are set by
+// running the command through env inside the sandbox. Variables that
+// could change how the runtime itself behaves are not allowed.
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// prefixes of environment variables read by the dynamic linker, libc,
+// or the language runtimes
+var reservedEnvPrefixes = []string{
+	"LD_", "MALLOC_", "GLIBC_", "GCONV_",
+	"PYTHON", "JAVA_", "_JAVA_", "JDK_", "GO", "CGO_",
+}
+
+var reservedEnvNames = map[string]bool{
+	"PATH":        true,
+	"CLASSPATH":   true,
+	"ENV":         true,
+	"BASH_ENV":    true,
+	"HOSTALIASES": true,
+	"LOCALDOMAIN": true,
+	"RES_OPTIONS": true,
+	"NLSPATH":     true,
+	"TZDIR":       true,
+}
+
+// validateArgs checks the arguments and environment of one test
+func validateArgs(args []string, env map[string]string) error {
+	if len(args)+len(env) > MaxTestArgs {
+		return fmt.Errorf("at most %d arguments and environment variables are allowed", MaxTestArgs)
+	}
+	size := 0
+	for _, arg := range args {
+		if strings.Contains(arg, "\x00") {
+			return fmt.Errorf("arguments must not contain NUL bytes")
+		}
+		size += len(arg)
+	}
+	for name, value := range env {
+		if !envName.MatchString(name) {
+			return fmt.Errorf("%q is not a valid environment variable name", name)
+		}
+		if err := checkEnvName(name); err != nil {
+			return err
+		}
+		if strings.Contains(value, "\x00") {
+			return fmt.Errorf("environment variable %s must not contain NUL bytes", name)
+		}
+		size += len(name) + len(value)
+	}
+	if size > MaxTestArgsKB*1024 {
+		return fmt.Errorf("arguments and environment variables must total at most %d kilobytes", MaxTestArgsKB)
+	}
+	return nil
+}
+
+func checkEnvName(name string) error {
+	upper := strings.ToUpper(name)
+	if reservedEnvNames[upper] {
+		return fmt.Errorf("environment variable %s is not allowed", name)
+	}
+	for _, prefix := range reservedEnvPrefixes {
+		if strings.HasPrefix(upper, prefix) {
+			return fmt.Errorf("environment variables starting with %s are not allowed", prefix)
+		}
+	}
+	return nil
+}
+
+// commandLine adds a test's arguments and environment to the command
+// line a kind runs
+func commandLine(command, args []string, env map[string]string) []string {
+	lst := []string{}
+	if len(env) > 0 {
+		lst = append(lst, "/usr/bin/env")
+		for _, name := range sortedNames(env) {
+			lst = append(lst, name+"="+env[name])
+		}
+	}
+	lst = append(lst, command...)
+	return append(lst, args...)
+}
+
+// signArgs adds a test's arguments and environment to a signature. A
+// test with neither adds nothing.
+func signArgs(h io.Writer, args []string, env map[string]string) {
+	for _, arg := range args {
+		fmt.Fprintf(h, "\ue000arg:%s", arg)
+	}
+	for _, name := range sortedNames(env) {
+		fmt.Fprintf(h, "\ue000env:%s=%s", name, env[name])
+	}
+}
+
+func sortedNames(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// build is a compiled solution shared by the tests that use it
+type build struct {
+	// closed once the build has finished
+	done chan struct{}
+
+	dir string
+	err error
+
+	// non-nil if compilation failed
+	result *TestResult
+}
+
+// Build compiles source (with test, if the kind builds per test) once per
+// request and returns the result. The build directory also holds the
+// solution's extra files and the support files, so they are available
+// to the compiler and are copied along with the compiled solution. A
+// failed compile is not an error; it is reported through build.result.
+// Tests that need a build already in progress wait for it to finish.
+func (req *CommonRequest) Build(kind ProblemKind, compiler Compiler, source string, files FileSet, test string) (*build, error) {
+	if !compiler.BuildPerTest() {
+		test = ""
+	}
+
+	// create a signature
+	h := sha1.New()
+	fmt.Fprintf(h, "%s", kind.Description().Tag)
+	fmt.Fprintf(h, "\ue000%s\ue000%s", source, test)
+	files.Sign(h, "solution")
+	key := fmt.Sprintf("%x", h.Sum(nil))
+
+	req.mutex.Lock()
+	if b, present := req.builds[key]; present {
+		req.mutex.Unlock()
+		<-b.done
+		return b, b.err
+	}
+	b := &build{done: make(chan struct{})}
+	if req.builds == nil {
+		req.builds = make(map[string]*build)
+	}
+	req.builds[key] = b
+	req.mutex.Unlock()
+
+	b.result, b.err = req.compile(kind, compiler, b, source, files, test)
+	close(b.done)
+	return b, b.err
+}
+
+func (req *CommonRequest) compile(kind ProblemKind, compiler Compiler, b *build, source string, files FileSet, test string) (*TestResult, error) {
+	// create a build directory
+	dirname, err := ioutil.TempDir("", "build")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create build directory: %v", err)
+	}
+	b.dir = dirname
+
+	extra := append(files.paths(), req.SupportFiles.paths()...)
+	args, err := compiler.PrepareBuild(dirname, source, test, extra)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.writeFiles(dirname, files); err != nil {
+		return nil, err
+	}
+	maxMB := CompileMaxMB
+	if manager, ok := kind.(MemoryManager); ok {
+		maxMB = manager.SandboxMB(maxMB)
+	}
+	result, err := runSandbox(dirname, args, "", CompileMaxSeconds*time.Second, maxMB, MaxOutputKB*1024)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Error {
+		return nil, nil
+	}
+	result.CompileError = true
+	return result, nil
+}
+
+// Cleanup removes any build directories created for this request
+func (req *CommonRequest) Cleanup() {
+	req.mutex.Lock()
+	defer req.mutex.Unlock()
+	for _, b := range req.builds {
+		if b.dir != "" {
+			os.RemoveAll(b.dir)
+		}
+	}
+	req.builds = nil
+}
+
+// copyDir copies the regular files and directories in src into dst,
+// keeping the files' modes
+func copyDir(src, dst string) error {
+	infos, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		from, to := filepath.Join(src, info.Name()), filepath.Join(dst, info.Name())
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(to, 0755); err != nil {
+				return err
+			}
+			if err := copyDir(from, to); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copyFile(from, to, info.Mode()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+)
+
+// C problems take the same fields as Python 2.7 problems with C
+// syntax for the source fields, and C module tests are programs
+// linked with the solution rather than Python test drivers
+
+var CModuleDescription = &ProblemType{
+	Name: "C Module",
+	Tag:  "cmodule",
+	FieldList: withTitles(withSourceType(Python27ModuleDescription.FieldList, "python", "c"), map[string]string{
+		"Tests":       "This program will be compiled and linked with your code",
+		"HiddenTests": "This program will also be compiled and linked with your code",
+	}),
+}
+
+var CStdinDescription = &ProblemType{
+	Name:      "C Stdin",
+	Tag:       "cstdin",
+	FieldList: withSourceType(Python27StdinDescription.FieldList, "python", "c"),
+}
+
+// C++ problems take the same fields as their C counterparts
+// with C++ syntax for the source fields
+
+var CPPModuleDescription = &ProblemType{
+	Name:      "C++ Module",
+	Tag:       "cppmodule",
+	FieldList: withSourceType(CModuleDescription.FieldList, "c", "cpp"),
+}
+
+var CPPStdinDescription = &ProblemType{
+	Name:      "C++ Stdin",
+	Tag:       "cppstdin",
+	FieldList: withSourceType(CStdinDescription.FieldList, "c", "cpp"),
+}
+
+func init() {
+	RegisterKind(&cKind{description: CStdinDescription, compiler: &GCCPath, ext: ".c", std: "-std=gnu11", isModule: false})
+	RegisterKind(&cKind{description: CModuleDescription, compiler: &GCCPath, ext: ".c", std: "-std=gnu11", isModule: true})
+	RegisterKind(&cKind{description: CPPStdinDescription, compiler: &GPPPath, ext: ".cpp", std: "-std=gnu++1y", isModule: false})
+	RegisterKind(&cKind{description: CPPModuleDescription, compiler: &GPPPath, ext: ".cpp", std: "-std=gnu++1y", isModule: true})
+}
+
+// cKind compiles C or C++ code and runs the resulting executable.
+// Stdin-driven solutions are compiled once; module solutions are linked
+// with each test driver, which supplies main.
+type cKind struct {
+	description *ProblemType
+	compiler    *string
+	ext         string
+	std         string
+	isModule    bool
+}
+
+func (kind *cKind) Description() *ProblemType {
+	return kind.description
+}
+
+func (kind *cKind) Validate(req *CommonRequest) error {
+	return nil
+}
+
+func (kind *cKind) BuildPerTest() bool {
+	return kind.isModule
+}
+
+// extra source files with the kind's extension are compiled along
+// with the solution; headers and other files are just available
+func (kind *cKind) PrepareBuild(dir, source, test string, extra []string) ([]string, error) {
+	main := "main" + kind.ext
+	args := []string{*kind.compiler, kind.std, "-O2", "-Wall", "-o", "main", main}
+	if kind.isModule {
+		if err := ioutil.WriteFile(filepath.Join(dir, main), []byte(test), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to create %s file: %v", main, err)
+		}
+		candidate := "Candidate" + kind.ext
+		if err := ioutil.WriteFile(filepath.Join(dir, candidate), []byte(source), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to create %s file: %v", candidate, err)
+		}
+		args = append(args, candidate)
+	} else {
+		if err := ioutil.WriteFile(filepath.Join(dir, main), []byte(source), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to create %s file: %v", main, err)
+		}
+	}
+	for _, p := range extra {
+		// a leading ./ keeps a file name from being read as an option
+		if path.Ext(p) == kind.ext {
+			args = append(args, "./"+p)
+		}
+	}
+	return append(args, "-lm"), nil
+}
+
+func (kind *cKind) ReservedFiles(source string) []string {
+	if kind.isModule {
+		return []string{"main" + kind.ext, "Candidate" + kind.ext, "main"}
+	}
+	return []string{"main" + kind.ext, "main"}
+}
+
+func (kind *cKind) VersionCommand() []string {
+	return []string{*kind.compiler, "--version"}
+}
+
+func (kind *cKind) Prepare(dir, source, test string) error {
+	// everything needed was produced by the build
+	return nil
+}
+
+func (kind *cKind) Command(req *CommonRequest, source, test string) ([]string, string) {
+	if kind.isModule {
+		return []string{"./main"}, ""
+	}
+	return []string{"./main"}, test
+}
+
+func (kind *cKind) Compare(req *CommonRequest, ref, cand *TestResult) bool {
+	return req.CompareOutput(ref.Stdout, cand.Stdout)
+}
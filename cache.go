@@ -0,0 +1,160 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ResultCache holds reference solution results keyed by signature.
+// It is safe for concurrent use, bounded by both entry count and the
+// approximate bytes held, and evicts the least recently used entries
+// first. Concurrent lookups of a missing key share a single run.
+// Misses fall back to the disk store, if there is one.
+type ResultCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	hits       uint64
+	misses     uint64
+	diskHits   uint64
+	evictions  uint64
+	store      *DiskStore
+
+	// most recently used at the front
+	lru     *list.List
+	entries map[string]*list.Element
+
+	// runs in progress
+	pending map[string]*cacheCall
+}
+
+type cacheEntry struct {
+	key    string
+	result *TestResult
+	size   int64
+}
+
+type cacheCall struct {
+	done   chan struct{}
+	result *TestResult
+	err    error
+}
+
+// CacheStats is a snapshot of the cache counters
+type CacheStats struct {
+	Entries    int
+	Bytes      int64
+	MaxEntries int
+	MaxBytes   int64
+	Hits       uint64
+	Misses     uint64
+	DiskHits   uint64
+	Evictions  uint64
+}
+
+// NewResultCache creates an empty cache. store may be nil.
+func NewResultCache(maxEntries int, maxBytes int64, store *DiskStore) *ResultCache {
+	return &ResultCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		store:      store,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+		pending:    make(map[string]*cacheCall),
+	}
+}
+
+// Get returns the cached result for key, calling run to produce it on a
+// miss. Only successful runs are cached. If a run for key is already in
+// progress, Get waits for it and returns its result instead.
+func (c *ResultCache) Get(key string, run func() (*TestResult, error)) (*TestResult, error) {
+	c.mutex.Lock()
+	if elt, present := c.entries[key]; present {
+		c.lru.MoveToFront(elt)
+		c.hits++
+		c.mutex.Unlock()
+		return elt.Value.(*cacheEntry).result, nil
+	}
+	if call, present := c.pending[key]; present {
+		c.hits++
+		c.mutex.Unlock()
+		<-call.done
+		return call.result, call.err
+	}
+	c.misses++
+	call := &cacheCall{done: make(chan struct{})}
+	c.pending[key] = call
+	c.mutex.Unlock()
+
+	fromDisk := false
+	if c.store != nil {
+		call.result, fromDisk = c.store.Load(key)
+	}
+	if !fromDisk {
+		call.result, call.err = run()
+		if call.err == nil && c.store != nil {
+			c.store.Save(key, call.result)
+		}
+	}
+
+	c.mutex.Lock()
+	delete(c.pending, key)
+	if call.err == nil {
+		c.add(key, call.result)
+	}
+	if fromDisk {
+		c.diskHits++
+	}
+	c.mutex.Unlock()
+	close(call.done)
+
+	return call.result, call.err
+}
+
+// add inserts a result and evicts old entries to make room.
+// The caller must hold the mutex.
+func (c *ResultCache) add(key string, result *TestResult) {
+	size := resultSize(key, result)
+	if size > c.maxBytes {
+		return
+	}
+	elt := c.lru.PushFront(&cacheEntry{key: key, result: result, size: size})
+	c.entries[key] = elt
+	c.bytes += size
+	for c.lru.Len() > c.maxEntries || c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+}
+
+func (c *ResultCache) remove(elt *list.Element) {
+	entry := c.lru.Remove(elt).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *ResultCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CacheStats{
+		Entries:    c.lru.Len(),
+		Bytes:      c.bytes,
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+		Hits:       c.hits,
+		Misses:     c.misses,
+		DiskHits:   c.diskHits,
+		Evictions:  c.evictions,
+	}
+}
+
+// resultSize approximates the memory held by a cache entry
+func resultSize(key string, result *TestResult) int64 {
+	const overhead = 128
+	size := overhead + len(key) + len(result.Message) + len(result.Stdout) + len(result.Stderr)
+	for p, contents := range result.Files {
+		size += overhead + len(p) + len(contents)
+	}
+	return int64(size)
+}
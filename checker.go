@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A checker is an instructor-supplied Python 3 script that decides
+// whether a candidate's output is acceptable, for problems with more
+// than one correct answer. It runs in the sandbox as
+//
+//	checker.py input.txt expected.txt output.txt
+//
+// and should exit with status 0 to accept the output or 42 to reject it.
+// Anything it prints on stdout is passed along to the student. Any
+// other outcome is an error in the checker: the test fails, but it is
+// reported as a checker error rather than a wrong answer, and the
+// details are logged instead of shown, since they may quote the
+// checker. Python exits with status 1 on an uncaught exception, which
+// is why that status does not mean rejection.
+
+const (
+	CheckerAccept = 0
+	CheckerReject = 42
+)
+
+// checkerVerdict is the decision of a checker on one test
+type checkerVerdict struct {
+	Accepted bool
+	Error    bool
+	Message  string
+}
+
+// RunChecker runs the request's checker on one test
+func (req *CommonRequest) RunChecker(test string, ref, cand *TestResult) (*checkerVerdict, error) {
+	// create a sandbox directory
+	dirname, err := ioutil.TempDir("", "checker")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create checker directory: %v", err)
+	}
+	defer os.RemoveAll(dirname)
+
+	files := map[string]string{
+		"checker.py":   req.Checker,
+		"input.txt":    test,
+		"expected.txt": ref.Stdout,
+		"output.txt":   cand.Stdout,
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dirname, name), []byte(contents), 0644); err != nil {
+			return nil, fmt.Errorf("Failed to create %s file: %v", name, err)
+		}
+	}
+
+	args := append([]string{"/usr/bin/env"}, python3Env...)
+	args = append(args, Python3Path, "checker.py", "input.txt", "expected.txt", "output.txt")
+	result, err := runSandbox(dirname, args, "", CheckerMaxSeconds*time.Second, CheckerMaxMB, MaxOutputKB*1024)
+	if err != nil {
+		return nil, err
+	}
+
+	verdict := &checkerVerdict{Message: result.Stdout}
+	switch {
+	case result.Verdict == VerdictOK:
+		verdict.Accepted = true
+	case result.Verdict == VerdictNonzeroExit && result.ExitCode == CheckerReject:
+		verdict.Accepted = false
+	default:
+		verdict.Error = true
+		verdict.Message = result.Message
+		if result.Stderr != "" {
+			verdict.Message += "\n" + result.Stderr
+		}
+		log.Printf("  checker ended in error: %s", verdict.Message)
+	}
+	return verdict, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// output comparison modes
+const (
+	CompareExact            = "exact"
+	CompareIgnoreWhitespace = "ignore-whitespace"
+	CompareIgnoreCase       = "ignore-case"
+	CompareTokens           = "token"
+	CompareNumeric          = "numeric"
+	CompareUnorderedLines   = "unordered-lines"
+)
+
+var compareModes = map[string]func(ref, cand string, epsilon float64) bool{
+	CompareExact:            compareExact,
+	CompareIgnoreWhitespace: compareIgnoreWhitespace,
+	CompareIgnoreCase:       compareIgnoreCase,
+	CompareTokens:           compareTokens,
+	CompareNumeric:          compareNumeric,
+	CompareUnorderedLines:   compareUnorderedLines,
+}
+
+// validateCompare checks the comparison settings and fills in defaults
+func (elt *CommonRequest) validateCompare() error {
+	if elt.Compare == "" {
+		elt.Compare = CompareExact
+	}
+	if _, present := compareModes[elt.Compare]; !present {
+		return fmt.Errorf("Compare must be one of %s, %s, %s, %s, %s, or %s",
+			CompareExact, CompareIgnoreWhitespace, CompareIgnoreCase,
+			CompareTokens, CompareNumeric, CompareUnorderedLines)
+	}
+	if elt.Epsilon < 0 {
+		return fmt.Errorf("Epsilon must be >= 0")
+	} else if elt.Epsilon == 0 {
+		elt.Epsilon = DefaultEpsilon
+	}
+	return nil
+}
+
+// CompareOutput reports whether the candidate output matches the
+// reference output under the request's comparison mode
+func (req *CommonRequest) CompareOutput(ref, cand string) bool {
+	return compareModes[req.Compare](ref, cand, req.Epsilon)
+}
+
+func compareExact(ref, cand string, epsilon float64) bool {
+	return ref == cand
+}
+
+// normalizeLines splits s into lines with runs of whitespace collapsed
+// and leading and trailing whitespace and blank lines removed
+func normalizeLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func compareIgnoreWhitespace(ref, cand string, epsilon float64) bool {
+	return equalLines(normalizeLines(ref), normalizeLines(cand))
+}
+
+func compareIgnoreCase(ref, cand string, epsilon float64) bool {
+	return strings.EqualFold(ref, cand)
+}
+
+func compareTokens(ref, cand string, epsilon float64) bool {
+	return equalLines(strings.Fields(ref), strings.Fields(cand))
+}
+
+// compareNumeric compares token by token. Tokens that are both numbers
+// match if they are within epsilon of each other, either absolutely or
+// relative to the reference value; other tokens must match exactly.
+func compareNumeric(ref, cand string, epsilon float64) bool {
+	a, b := strings.Fields(ref), strings.Fields(cand)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		x, errx := strconv.ParseFloat(a[i], 64)
+		y, erry := strconv.ParseFloat(b[i], 64)
+		if errx != nil || erry != nil || math.IsNaN(x) || math.IsNaN(y) {
+			return false
+		}
+		// an infinite reference would make any relative difference
+		// acceptable, so infinities must match exactly
+		if math.IsInf(x, 0) || math.IsInf(y, 0) {
+			if x != y {
+				return false
+			}
+			continue
+		}
+		diff := math.Abs(x - y)
+		if diff > epsilon && diff > epsilon*math.Abs(x) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareUnorderedLines(ref, cand string, epsilon float64) bool {
+	a, b := normalizeLines(ref), normalizeLines(cand)
+	sort.Strings(a)
+	sort.Strings(b)
+	return equalLines(a, b)
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestCompareModes(t *testing.T) {
+	tests := []struct {
+		mode      string
+		ref, cand string
+		epsilon   float64
+		want      bool
+	}{
+		{CompareExact, "1 2\n", "1 2\n", 0, true},
+		{CompareExact, "1 2\n", "1  2\n", 0, false},
+		{CompareExact, "1 2\n", "1 2", 0, false},
+
+		{CompareIgnoreWhitespace, "1 2\n", "  1\t2  \n\n\n", 0, true},
+		{CompareIgnoreWhitespace, "1 2\n", "1\n2\n", 0, false},
+		{CompareIgnoreWhitespace, "a\n\nb\n", "a\nb\n", 0, false},
+
+		{CompareIgnoreCase, "Hello\n", "hELLO\n", 0, true},
+		{CompareIgnoreCase, "Hello\n", "Hello \n", 0, false},
+
+		{CompareTokens, "1 2\n3\n", "1\n2 3", 0, true},
+		{CompareTokens, "1 2 3\n", "1 2\n", 0, false},
+
+		{CompareNumeric, "3.14159\n", "3.1416\n", 1e-4, true},
+		{CompareNumeric, "3.14159\n", "3.15\n", 1e-4, false},
+		{CompareNumeric, "1e9\n", "1.0000001e9\n", 1e-6, true},
+		{CompareNumeric, "x = 1\n", "x = 1.0000001\n", 1e-6, true},
+		{CompareNumeric, "x = 1\n", "y = 1\n", 1e-6, false},
+		{CompareNumeric, "1 2\n", "1\n", 1e-6, false},
+		{CompareNumeric, "nan\n", "nan\n", 1e-6, true},
+		{CompareNumeric, "nan\n", "NaN\n", 1e-6, false},
+		{CompareNumeric, "1\n", "nan\n", 1e-6, false},
+		{CompareNumeric, "inf\n", "inf\n", 1e-6, true},
+		{CompareNumeric, "inf\n", "+Inf\n", 1e-6, true},
+		{CompareNumeric, "inf\n", "-inf\n", 1e-6, false},
+		{CompareNumeric, "-inf\n", "inf\n", 1e-6, false},
+		{CompareNumeric, "inf\n", "1e308\n", 1e-6, false},
+		{CompareNumeric, "1e308\n", "inf\n", 1e-6, false},
+
+		{CompareUnorderedLines, "a\nb\nc\n", "c\na\nb\n", 0, true},
+		{CompareUnorderedLines, "a\nb\nb\n", "a\na\nb\n", 0, false},
+	}
+	for _, test := range tests {
+		if got := compareModes[test.mode](test.ref, test.cand, test.epsilon); got != test.want {
+			t.Errorf("%s(%q, %q, %g) = %v, want %v", test.mode, test.ref, test.cand, test.epsilon, got, test.want)
+		}
+	}
+}
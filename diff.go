@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffOp is one line of a line-level diff
+type diffOp struct {
+	// ' ' for a shared line, '-' for a line only in the expected
+	// output, '+' for a line only in the actual output
+	kind byte
+	text string
+
+	// lines of each output that precede this one
+	a, b int
+}
+
+// splitLines splits output into lines, ignoring the final newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script turning a into b. The
+// common prefix and suffix are trimmed first; if what remains is too
+// large to compare line by line, it is reported as a single change.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{kind: ' ', text: a[prefix], a: prefix, b: prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	if len(x)*len(y) > DiffMaxCells {
+		for i, line := range x {
+			ops = append(ops, diffOp{kind: '-', text: line, a: prefix + i, b: prefix})
+		}
+		for j, line := range y {
+			ops = append(ops, diffOp{kind: '+', text: line, a: prefix + len(x), b: prefix + j})
+		}
+	} else {
+		// lcs[i*w+j] is the length of the longest common subsequence of
+		// x[i:] and y[j:], kept in one int32 table to bound memory use
+		w := len(y) + 1
+		lcs := make([]int32, (len(x)+1)*w)
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i*w+j] = lcs[(i+1)*w+j+1] + 1
+				} else if lcs[(i+1)*w+j] >= lcs[i*w+j+1] {
+					lcs[i*w+j] = lcs[(i+1)*w+j]
+				} else {
+					lcs[i*w+j] = lcs[i*w+j+1]
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				ops = append(ops, diffOp{kind: ' ', text: x[i], a: prefix + i, b: prefix + j})
+				i++
+				j++
+			case j == len(y) || (i < len(x) && lcs[(i+1)*w+j] >= lcs[i*w+j+1]):
+				ops = append(ops, diffOp{kind: '-', text: x[i], a: prefix + i, b: prefix + j})
+				i++
+			default:
+				ops = append(ops, diffOp{kind: '+', text: y[j], a: prefix + i, b: prefix + j})
+				j++
+			}
+		}
+	}
+
+	for k := 0; k < suffix; k++ {
+		i, j := len(a)-suffix+k, len(b)-suffix+k
+		ops = append(ops, diffOp{kind: ' ', text: a[i], a: i, b: j})
+	}
+	return ops
+}
+
+// unifiedDiff describes how actual differs from expected as a unified
+// diff with DiffContext lines of context, limited to DiffMaxLines lines.
+// It also returns the line number (counting from 1) of the first
+// expected line that differs, or 0 if the outputs have the same lines.
+func unifiedDiff(expected, actual string) (string, int) {
+	ops := diffLines(splitLines(expected), splitLines(actual))
+
+	first := -1
+	for n, op := range ops {
+		if op.kind != ' ' {
+			first = n
+			break
+		}
+	}
+	if first < 0 {
+		return "", 0
+	}
+
+	var lines []string
+	lines = append(lines, "--- expected", "+++ yours")
+	for start := first; start < len(ops); {
+		// find the extent of this hunk, merging changes separated by
+		// no more than twice the context
+		lo := start - DiffContext
+		if lo < 0 {
+			lo = 0
+		}
+		hi := start
+		for k := start; k < len(ops) && k <= hi+2*DiffContext; k++ {
+			if ops[k].kind != ' ' {
+				hi = k
+			}
+		}
+		end := hi + DiffContext + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		acount, bcount := 0, 0
+		for _, op := range ops[lo:end] {
+			if op.kind != '+' {
+				acount++
+			}
+			if op.kind != '-' {
+				bcount++
+			}
+		}
+		lines = append(lines, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(ops[lo].a, acount), hunkRange(ops[lo].b, bcount)))
+		for _, op := range ops[lo:end] {
+			lines = append(lines, string(op.kind)+op.text)
+		}
+
+		// move on to the next change
+		start = end
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+	}
+
+	if len(lines) > DiffMaxLines {
+		lines = append(lines[:DiffMaxLines], fmt.Sprintf("... %d more diff lines not shown", len(lines)-DiffMaxLines))
+	}
+	return strings.Join(lines, "\n") + "\n", ops[first].a + 1
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		diff             string
+		first            int
+	}{
+		{"same\n", "same\n", "", 0},
+		{"a\nb\n", "a\nb", "", 0},
+		{
+			"a\nb\nc\n", "a\nx\nc\n",
+			"--- expected\n+++ yours\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n", 2,
+		},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "1\n2\n3\n4\n5\n6\n7\n8\n9\nX\n",
+			"--- expected\n+++ yours\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+X\n", 10,
+		},
+		{"", "a\n", "--- expected\n+++ yours\n@@ -0,0 +1 @@\n+a\n", 1},
+		{"a\n", "", "--- expected\n+++ yours\n@@ -1 +0,0 @@\n-a\n", 1},
+		{
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- expected\n+++ yours\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n", 1,
+		},
+	}
+	for _, test := range tests {
+		diff, first := unifiedDiff(test.expected, test.actual)
+		if diff != test.diff || first != test.first {
+			t.Errorf("unifiedDiff(%q, %q) = %q, %d, want %q, %d", test.expected, test.actual, diff, first, test.diff, test.first)
+		}
+	}
+}
+
+func TestDiffLinesTooLarge(t *testing.T) {
+	// past DiffMaxCells the changed region is reported as one change
+	a := splitLines(strings.Repeat("a\n", 600))
+	b := splitLines(strings.Repeat("b\n", 600))
+	if len(a)*len(b) <= DiffMaxCells {
+		t.Fatalf("test inputs fit within DiffMaxCells")
+	}
+	ops := diffLines(a, b)
+	if len(ops) != len(a)+len(b) {
+		t.Fatalf("diffLines returned %d ops, want %d", len(ops), len(a)+len(b))
+	}
+	for i, op := range ops {
+		want := byte('-')
+		if i >= len(a) {
+			want = '+'
+		}
+		if op.kind != want {
+			t.Fatalf("op %d is %q, want %q", i, op.kind, want)
+		}
+	}
+}
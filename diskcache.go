@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DiskStore persists reference results across restarts. Each result is
+// stored in its own file named by its cache key along with a checksum;
+// files that fail to verify are discarded. When the store grows past
+// its size cap, the least recently used files are removed.
+type DiskStore struct {
+	mutex    sync.Mutex
+	dir      string
+	maxBytes int64
+	bytes    int64
+}
+
+// diskEntry is the on-disk format of a stored result
+type diskEntry struct {
+	Key      string
+	Checksum string
+	Result   json.RawMessage
+}
+
+// NewDiskStore opens (creating if necessary) a store rooted at dir
+func NewDiskStore(dir string, maxBytes int64) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	store := &DiskStore{dir: dir, maxBytes: maxBytes}
+	files, err := store.files()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range files {
+		store.bytes += info.size
+	}
+	log.Printf("Disk cache %s holds %d results (%d bytes)", dir, len(files), store.bytes)
+	return store, nil
+}
+
+func (store *DiskStore) path(key string) string {
+	return filepath.Join(store.dir, key[:2], key+".json")
+}
+
+// Load returns the stored result for key, if present and intact
+func (store *DiskStore) Load(key string) (*TestResult, bool) {
+	path := store.path(key)
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading cached result %s: %v", path, err)
+		}
+		return nil, false
+	}
+	entry := new(diskEntry)
+	result := new(TestResult)
+	if err := json.Unmarshal(raw, entry); err != nil {
+		store.discard(path, fmt.Errorf("decoding entry: %v", err))
+		return nil, false
+	}
+	if entry.Key != key || entry.Checksum != checksum(entry.Result) {
+		store.discard(path, fmt.Errorf("checksum mismatch"))
+		return nil, false
+	}
+	if err := json.Unmarshal(entry.Result, result); err != nil {
+		store.discard(path, fmt.Errorf("decoding result: %v", err))
+		return nil, false
+	}
+
+	// mark it as recently used
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return result, true
+}
+
+// Save writes a result for key, replacing any existing one
+func (store *DiskStore) Save(key string, result *TestResult) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("Error encoding result for disk cache: %v", err)
+		return
+	}
+	data, err := json.Marshal(&diskEntry{Key: key, Checksum: checksum(raw), Result: raw})
+	if err != nil {
+		log.Printf("Error encoding result for disk cache: %v", err)
+		return
+	}
+	if int64(len(data)) > store.maxBytes {
+		return
+	}
+
+	// write to a temporary file and rename it so readers never see a partial entry
+	path := store.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Error creating disk cache directory: %v", err)
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "tmp")
+	if err != nil {
+		log.Printf("Error creating disk cache file: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Error writing disk cache file: %v", err)
+		return
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if info, err := os.Stat(path); err == nil {
+		store.bytes -= info.Size()
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Error saving disk cache file: %v", err)
+		return
+	}
+	store.bytes += int64(len(data))
+	if store.bytes > store.maxBytes {
+		store.evict()
+	}
+}
+
+func (store *DiskStore) discard(path string, err error) {
+	log.Printf("Discarding cached result %s: %v", path, err)
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if info, err := os.Stat(path); err == nil {
+		store.bytes -= info.Size()
+	}
+	os.Remove(path)
+}
+
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// files lists the stored entries
+func (store *DiskStore) files() ([]diskFile, error) {
+	var lst []diskFile
+	err := filepath.Walk(store.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && filepath.Ext(path) == ".json" {
+			lst = append(lst, diskFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	return lst, err
+}
+
+// evict removes the least recently used entries until the store is
+// back under 90% of its cap. The caller must hold the mutex.
+func (store *DiskStore) evict() {
+	files, err := store.files()
+	if err != nil {
+		log.Printf("Error scanning disk cache: %v", err)
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	total := int64(0)
+	for _, info := range files {
+		total += info.size
+	}
+	target := store.maxBytes / 10 * 9
+	removed := 0
+	for _, info := range files {
+		if total <= target {
+			break
+		}
+		if err := os.Remove(info.path); err == nil {
+			total -= info.size
+			removed++
+		}
+	}
+	store.bytes = total
+	log.Printf("Disk cache evicted %d results", removed)
+}
+
+func checksum(raw []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(raw))
+}
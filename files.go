@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// File is an extra file for a solution. In JSON it is either a string
+// holding the file's text or an object whose Content may be base64
+// encoded binary data.
+type File struct {
+	Content string
+	Base64  bool
+
+	// the file's contents, set by FileSet.Validate
+	data []byte
+}
+
+func (f *File) UnmarshalJSON(raw []byte) error {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		*f = File{Content: text}
+		return nil
+	}
+	type plain File
+	return json.Unmarshal(raw, (*plain)(f))
+}
+
+// FileSet maps slash-separated paths, relative to the sandbox
+// directory, to files
+type FileSet map[string]*File
+
+// Validate checks the paths and decodes the contents of a file set.
+// name is the request field it came from.
+func (files FileSet) Validate(name string) error {
+	if len(files) > MaxFiles {
+		return fmt.Errorf("%s must have at most %d files", name, MaxFiles)
+	}
+	size := 0
+	paths := files.paths()
+	for i, p := range paths {
+		f := files[p]
+		if err := validatePath(p); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		for _, other := range paths[:i] {
+			if pathsConflict(p, other) {
+				return fmt.Errorf("%s: %s and %s conflict", name, other, p)
+			}
+		}
+		if f == nil {
+			return fmt.Errorf("%s: %s has no content", name, p)
+		}
+		if f.Base64 {
+			data, err := base64.StdEncoding.DecodeString(f.Content)
+			if err != nil {
+				return fmt.Errorf("%s: %s is not valid base64: %v", name, p, err)
+			}
+			f.data = data
+		} else {
+			f.data = []byte(f.Content)
+		}
+		size += len(f.data)
+	}
+	if size > MaxFilesKB*1024 {
+		return fmt.Errorf("%s must total at most %d kilobytes", name, MaxFilesKB)
+	}
+	return nil
+}
+
+// validatePath accepts only clean relative paths that stay inside the
+// sandbox directory
+func validatePath(p string) error {
+	switch {
+	case p == "":
+		return fmt.Errorf("file path must not be empty")
+	case strings.ContainsAny(p, "\\\x00"):
+		return fmt.Errorf("file path %q must not contain backslashes or NUL bytes", p)
+	case path.IsAbs(p):
+		return fmt.Errorf("file path %q must be relative", p)
+	case path.Clean(p) != p || p == "." || p == ".." || strings.HasPrefix(p, "../"):
+		return fmt.Errorf("file path %q must be clean and must not leave the sandbox directory", p)
+	}
+	return nil
+}
+
+// pathsConflict reports whether two files cannot both be created,
+// because they have the same path or one would be a directory holding
+// the other
+func pathsConflict(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
+
+// Write creates the files under dir with the given mode. It never
+// replaces an existing file, so solution files cannot clobber the files
+// a kind sets up.
+func (files FileSet) Write(dir string, mode os.FileMode) error {
+	for p, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return fmt.Errorf("Failed to create directory for %s: %v", p, err)
+		}
+		fp, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+		if err != nil {
+			if os.IsExist(err) {
+				return fmt.Errorf("File %s conflicts with a file used to run the solution", p)
+			}
+			return fmt.Errorf("Failed to create %s: %v", p, err)
+		}
+		if _, err := fp.Write(f.data); err != nil {
+			fp.Close()
+			return fmt.Errorf("Failed to write %s: %v", p, err)
+		}
+		if err := fp.Close(); err != nil {
+			return fmt.Errorf("Failed to write %s: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// Sign adds the files to a signature, in path order. An empty set adds
+// nothing.
+func (files FileSet) Sign(h io.Writer, label string) {
+	for _, p := range files.paths() {
+		fmt.Fprintf(h, "\ue000%s:%s\ue000%d\ue000", label, p, len(files[p].data))
+		h.Write(files[p].data)
+	}
+}
+
+func (files FileSet) paths() []string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// checkOverlap reports paths in a solution's files that conflict with
+// the support files
+func checkOverlap(files, support FileSet, name string) error {
+	for _, p := range files.paths() {
+		for _, other := range support.paths() {
+			if pathsConflict(p, other) {
+				return fmt.Errorf("%s %s conflicts with SupportFiles %s", name, p, other)
+			}
+		}
+	}
+	return nil
+}
+
+// checkReserved reports paths in a file set that conflict with the
+// files a kind writes to run a solution
+func checkReserved(files FileSet, reserved []string, name string) error {
+	for _, p := range files.paths() {
+		for _, r := range reserved {
+			if p == r {
+				return fmt.Errorf("%s: %s is used to run the solution", name, p)
+			} else if pathsConflict(p, r) {
+				return fmt.Errorf("%s: %s conflicts with %s, which is used to run the solution", name, p, r)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import "testing"
+
+func TestValidatePath(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"data.txt", true},
+		{"lib/util.py", true},
+		{".hidden", true},
+		{"a/..b", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../x", false},
+		{"a/../../x", false},
+		{"/etc/passwd", false},
+		{"a//b", false},
+		{"a/./b", false},
+		{"a/", false},
+		{"a\\b", false},
+		{"a\x00b", false},
+	}
+	for _, test := range tests {
+		if err := validatePath(test.path); (err == nil) != test.ok {
+			t.Errorf("validatePath(%q) = %v, want ok = %v", test.path, err, test.ok)
+		}
+	}
+}
+
+func TestPathsConflict(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		conflict bool
+	}{
+		{"a", "a", true},
+		{"a", "a/b", true},
+		{"a/b/c", "a", true},
+		{"a", "ab", false},
+		{"a/b", "a/c", false},
+		{"ab/c", "a", false},
+	}
+	for _, test := range tests {
+		if got := pathsConflict(test.a, test.b); got != test.conflict {
+			t.Errorf("pathsConflict(%q, %q) = %v, want %v", test.a, test.b, got, test.conflict)
+		}
+	}
+}
+
+func TestFileSetValidate(t *testing.T) {
+	tests := []struct {
+		files FileSet
+		ok    bool
+	}{
+		{FileSet{"a.txt": {Content: "x"}, "lib/b.txt": {Content: "y"}}, true},
+		{FileSet{"a.bin": {Content: "aGk=", Base64: true}}, true},
+		{FileSet{"a.bin": {Content: "not base64", Base64: true}}, false},
+		{FileSet{"a": nil}, false},
+		{FileSet{"a": {Content: "x"}, "a/b": {Content: "y"}}, false},
+		{FileSet{"../a": {Content: "x"}}, false},
+	}
+	for _, test := range tests {
+		if err := test.files.Validate("Files"); (err == nil) != test.ok {
+			t.Errorf("Validate(%v) = %v, want ok = %v", test.files, err, test.ok)
+		}
+	}
+
+	files := FileSet{"a.bin": {Content: "aGk=", Base64: true}}
+	if err := files.Validate("Files"); err != nil || string(files["a.bin"].data) != "hi" {
+		t.Errorf("base64 content decoded to %q, %v", files["a.bin"].data, err)
+	}
+}
+
+func TestCheckReserved(t *testing.T) {
+	reserved := []string{"main.py", "Candidate.py"}
+	tests := []struct {
+		files FileSet
+		ok    bool
+	}{
+		{FileSet{"helper.py": {}}, true},
+		{FileSet{"main.py": {}}, false},
+		{FileSet{"Candidate.py/x": {}}, false},
+	}
+	for _, test := range tests {
+		if err := checkReserved(test.files, reserved, "Files"); (err == nil) != test.ok {
+			t.Errorf("checkReserved(%v) = %v, want ok = %v", test.files, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// Go problems take the same fields as Python 2.7 stdin problems
+// with Go syntax for the source fields
+
+var GoStdinDescription = &ProblemType{
+	Name:      "Go Stdin",
+	Tag:       "gostdin",
+	FieldList: withSourceType(Python27StdinDescription.FieldList, "python", "go"),
+}
+
+func init() {
+	RegisterKind(&goKind{description: GoStdinDescription})
+}
+
+// goKind builds a single-file Go program once per solution. Builds
+// share a build cache that is warmed when the image is created and is
+// read-only to the sandbox, so the standard library is never rebuilt
+// and one submission cannot poison the cache for another.
+type goKind struct {
+	description *ProblemType
+}
+
+func (kind *goKind) Description() *ProblemType {
+	return kind.description
+}
+
+func (kind *goKind) Validate(req *CommonRequest) error {
+	return nil
+}
+
+func (kind *goKind) BuildPerTest() bool {
+	return false
+}
+
+// the whole directory is built, so extra Go files in it are part of
+// the program
+func (kind *goKind) PrepareBuild(dir, source, test string, extra []string) ([]string, error) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(source), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to create main.go file: %v", err)
+	}
+	return []string{"/usr/bin/env",
+		"GOCACHE=" + GoCachePath,
+		"GOPATH=" + filepath.Join(dir, "gopath"),
+		"GO111MODULE=off",
+		"GOTOOLCHAIN=local",
+		"GOENV=off",
+		"CGO_ENABLED=0",
+		GoPath, "build", "-o", "main", ".",
+	}, nil
+}
+
+func (kind *goKind) ReservedFiles(source string) []string {
+	return []string{"main.go", "main", "gopath"}
+}
+
+// the Go runtime reserves address space beyond what it uses, so the
+// sandbox limit is relaxed and the runtime is given a soft limit
+func (kind *goKind) SandboxMB(maxMB int) int {
+	return maxMB + GoOverheadMB
+}
+
+func (kind *goKind) VersionCommand() []string {
+	return []string{GoPath, "version"}
+}
+
+func (kind *goKind) Prepare(dir, source, test string) error {
+	// everything needed was produced by the build
+	return nil
+}
+
+func (kind *goKind) Command(req *CommonRequest, source, test string) ([]string, string) {
+	return []string{"/usr/bin/env",
+		"GOMEMLIMIT=" + strconv.Itoa(req.MaxMB) + "MiB",
+		"./main",
+	}, test
+}
+
+func (kind *goKind) Compare(req *CommonRequest, ref, cand *TestResult) bool {
+	return req.CompareOutput(ref.Stdout, cand.Stdout)
+}
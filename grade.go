@@ -0,0 +1,820 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maps hash of testtype:referencesolution:testdata to *TestResult
+// only used for reference solutions; replaced by main using the
+// configured limits
+var cache = NewResultCache(DefaultCacheEntries, DefaultCacheMB<<20, nil)
+
+type CommonRequest struct {
+	Reference   string
+	Candidate   string
+	Tests       []TestSpec
+	HiddenTests []TestSpec
+
+	// extra files written alongside each solution, and read-only files
+	// provided to both; see files.go
+	ReferenceFiles FileSet
+	CandidateFiles FileSet
+	SupportFiles   FileSet
+
+	// files each run is expected to write, compared like stdout
+	ExpectedFiles []string
+
+	// optional points for each test; every test is worth 1 by default
+	Weights       []int
+	HiddenWeights []int
+
+	// optional command line arguments and environment variables for
+	// each test; see args.go
+	Args       [][]string
+	HiddenArgs [][]string
+	Env        []map[string]string
+	HiddenEnv  []map[string]string
+
+	// how output is compared; see compare.go
+	Compare string
+	Epsilon float64
+
+	// optional script that replaces output comparison; see checker.go
+	Checker string
+
+	MaxSeconds  int
+	MaxMB       int
+	MaxOutputKB int
+
+	// if set, the candidate's time limit on each test is this multiple
+	// of the reference solution's running time on that test, but no
+	// less than MinSeconds and no more than MaxSeconds
+	TimeMultiplier float64
+	MinSeconds     float64
+
+	// the non-empty tests, set by Validate
+	cases       []*testCase
+	hiddenCases []*testCase
+
+	// compiled solutions, keyed by build signature
+	mutex  sync.Mutex
+	builds map[string]*build
+}
+
+// testCase is one test as it is run: the test text, which is stdin or a
+// test driver depending on the kind, the points it is worth, and the
+// command line arguments and environment given to the solution. The
+// rest come from the object form of a test; see TestSpec.
+type testCase struct {
+	Input  string
+	Weight int
+	Args   []string
+	Env    map[string]string
+
+	Name     string
+	Expected *string
+	Timeout  time.Duration
+}
+
+func (elt *CommonRequest) Validate() error {
+	// check Reference solution
+	elt.Reference = fixLineEndings(elt.Reference)
+	if isEmpty(elt.Reference) {
+		return fmt.Errorf("Reference solution is required")
+	}
+
+	// check Candidate solution
+	elt.Candidate = fixLineEndings(elt.Candidate)
+
+	// check extra files
+	if err := elt.validateFiles(); err != nil {
+		return err
+	}
+	if err := elt.validateExpectedFiles(); err != nil {
+		return err
+	}
+
+	// check Test list
+	var err error
+	elt.cases, err = filterTests(elt.Tests, elt.Weights, elt.Args, elt.Env, "")
+	if err != nil {
+		return err
+	}
+	if len(elt.cases) == 0 {
+		return fmt.Errorf("Tests list must not be empty")
+	}
+
+	// check HiddenTest list
+	elt.hiddenCases, err = filterTests(elt.HiddenTests, elt.HiddenWeights, elt.HiddenArgs, elt.HiddenEnv, "Hidden")
+	if err != nil {
+		return err
+	}
+
+	// check Compare and Epsilon
+	if err := elt.validateCompare(); err != nil {
+		return err
+	}
+
+	// check Checker
+	if isEmpty(elt.Checker) {
+		elt.Checker = ""
+	} else {
+		elt.Checker = fixLineEndings(elt.Checker)
+	}
+
+	// check MaxSeconds
+	if elt.MaxSeconds < 1 {
+		return fmt.Errorf("MaxSeconds must be >= 1")
+	} else if elt.MaxSeconds > MaxSeconds {
+		return fmt.Errorf("MaxSeconds must be <= %d", MaxSeconds)
+	}
+	for _, test := range append(append([]*testCase{}, elt.cases...), elt.hiddenCases...) {
+		if test.Timeout > time.Duration(elt.MaxSeconds)*time.Second {
+			return fmt.Errorf("Timeout must be <= MaxSeconds")
+		}
+	}
+
+	// check TimeMultiplier and MinSeconds
+	if elt.TimeMultiplier < 0 {
+		return fmt.Errorf("TimeMultiplier must be >= 0")
+	}
+	if elt.MinSeconds == 0 {
+		elt.MinSeconds = DefaultMinSeconds
+	}
+	if elt.MinSeconds < 0 {
+		return fmt.Errorf("MinSeconds must be > 0")
+	} else if elt.MinSeconds > float64(elt.MaxSeconds) {
+		return fmt.Errorf("MinSeconds must be <= MaxSeconds")
+	}
+
+	// check MaxMB
+	if elt.MaxMB < 1 {
+		return fmt.Errorf("MaxMB must be >= 1")
+	} else if elt.MaxMB > MaxMB {
+		return fmt.Errorf("MaxMB must be <= %d", MaxMB)
+	}
+
+	// check MaxOutputKB
+	if elt.MaxOutputKB == 0 {
+		elt.MaxOutputKB = MaxOutputKB
+	} else if elt.MaxOutputKB < 1 {
+		return fmt.Errorf("MaxOutputKB must be >= 1")
+	} else if elt.MaxOutputKB > MaxOutputKB {
+		return fmt.Errorf("MaxOutputKB must be <= %d", MaxOutputKB)
+	}
+
+	return nil
+}
+
+// validateFiles checks the extra files of both solutions and the
+// support files
+func (elt *CommonRequest) validateFiles() error {
+	if err := elt.ReferenceFiles.Validate("ReferenceFiles"); err != nil {
+		return err
+	}
+	if err := elt.CandidateFiles.Validate("CandidateFiles"); err != nil {
+		return err
+	}
+	if err := elt.SupportFiles.Validate("SupportFiles"); err != nil {
+		return err
+	}
+	if err := checkOverlap(elt.ReferenceFiles, elt.SupportFiles, "ReferenceFiles"); err != nil {
+		return err
+	}
+	return checkOverlap(elt.CandidateFiles, elt.SupportFiles, "CandidateFiles")
+}
+
+// validateReservedFiles checks that no extra file takes a path the
+// kind uses to build or run a solution
+func (elt *CommonRequest) validateReservedFiles(kind ProblemKind) error {
+	reserver, ok := kind.(FileReserver)
+	if !ok {
+		return nil
+	}
+	reference, candidate := reserver.ReservedFiles(elt.Reference), reserver.ReservedFiles(elt.Candidate)
+	if err := checkReserved(elt.ReferenceFiles, reference, "ReferenceFiles"); err != nil {
+		return err
+	}
+	if err := checkReserved(elt.CandidateFiles, candidate, "CandidateFiles"); err != nil {
+		return err
+	}
+	if err := checkReserved(elt.SupportFiles, reference, "SupportFiles"); err != nil {
+		return err
+	}
+	return checkReserved(elt.SupportFiles, candidate, "SupportFiles")
+}
+
+// filterTests normalizes a test list and drops empty tests along with
+// their weights, arguments, and environments. Missing weights default
+// to 1, and the fields of a test given as an object take precedence
+// over the lists. prefix is "Hidden" for the hidden test fields.
+func filterTests(tests []TestSpec, weights []int, args [][]string, env []map[string]string, prefix string) ([]*testCase, error) {
+	if len(weights) > 0 && len(weights) != len(tests) {
+		return nil, fmt.Errorf("%sWeights must have one entry per test", prefix)
+	}
+	if len(args) > 0 && len(args) != len(tests) {
+		return nil, fmt.Errorf("%sArgs must have one entry per test", prefix)
+	}
+	if len(env) > 0 && len(env) != len(tests) {
+		return nil, fmt.Errorf("%sEnv must have one entry per test", prefix)
+	}
+	lst := []*testCase{}
+	for n, spec := range tests {
+		// blank entries are left over from editing a list of strings,
+		// but an object may have empty input, e.g., to test arguments
+		if spec.plain && isEmpty(spec.Input) {
+			continue
+		}
+		// anything in Tests is shown to students
+		if spec.Hidden && prefix == "" {
+			return nil, fmt.Errorf("Tests entry %d is hidden; put hidden tests in HiddenTests", n+1)
+		}
+		tc := &testCase{Input: spec.Input, Weight: 1, Name: spec.Name}
+		if tc.Input != "" {
+			tc.Input = fixLineEndings(tc.Input)
+		}
+		if spec.Weight != nil {
+			tc.Weight = *spec.Weight
+		} else if len(weights) > 0 {
+			tc.Weight = weights[n]
+		}
+		if tc.Weight < 0 {
+			return nil, fmt.Errorf("%sWeights must be >= 0", prefix)
+		}
+		if spec.Args != nil {
+			tc.Args = spec.Args
+		} else if len(args) > 0 {
+			tc.Args = args[n]
+		}
+		if spec.Env != nil {
+			tc.Env = spec.Env
+		} else if len(env) > 0 {
+			tc.Env = env[n]
+		}
+		if err := validateArgs(tc.Args, tc.Env); err != nil {
+			return nil, fmt.Errorf("%sTests entry %d: %v", prefix, n+1, err)
+		}
+		if spec.Expected != nil {
+			expected := expectedOutput(*spec.Expected)
+			tc.Expected = &expected
+		}
+		if spec.Timeout < 0 {
+			return nil, fmt.Errorf("%sTests entry %d: Timeout must be >= 0", prefix, n+1)
+		}
+		tc.Timeout = time.Duration(spec.Timeout * float64(time.Second))
+
+		lst = append(lst, tc)
+	}
+	return lst, nil
+}
+
+func (req *CommonRequest) RunReferenceTest(kind ProblemKind, test *testCase, source string, files FileSet) (*TestResult, error) {
+	// create a signature
+	h := sha1.New()
+	fmt.Fprintf(h, "%s", kind.Description().Tag)
+	fmt.Fprintf(h, "\ue000%s", kindVersion(kind))
+	fmt.Fprintf(h, "\ue000%s\ue000%s", source, test.Input)
+	signArgs(h, test.Args, test.Env)
+	files.Sign(h, "solution")
+	req.SupportFiles.Sign(h, "support")
+	fmt.Fprintf(h, "\ue000limits:%d:%d", req.MaxSeconds, req.MaxMB)
+	fmt.Fprintf(h, "\ue000output:%d", req.MaxOutputKB)
+	if len(req.ExpectedFiles) > 0 {
+		fmt.Fprintf(h, "\ue000expected:%s", strings.Join(req.ExpectedFiles, "\ue000"))
+	}
+	key := fmt.Sprintf("%x", h.Sum(nil))
+	return cache.Get(key, func() (*TestResult, error) {
+		return req.RunTest(kind, test, source, files, req.TimeLimit(nil))
+	})
+}
+
+// TimeLimit gives the time limit for a run. Reference runs (ref == nil)
+// always get MaxSeconds; candidate runs are limited relative to the
+// reference run when TimeMultiplier is set.
+func (req *CommonRequest) TimeLimit(ref *TestResult) time.Duration {
+	max := time.Duration(req.MaxSeconds) * time.Second
+	if ref == nil || ref.Error || req.TimeMultiplier == 0 {
+		return max
+	}
+	limit := time.Duration(float64(ref.Elapsed) * req.TimeMultiplier)
+	if min := time.Duration(req.MinSeconds * float64(time.Second)); limit < min {
+		limit = min
+	}
+	if limit > max {
+		limit = max
+	}
+	return limit
+}
+
+// relativeLimit reports whether the candidate's time limit on a test
+// is based on the reference solution's time
+func (req *CommonRequest) relativeLimit(test *testCase) bool {
+	return req.TimeMultiplier > 0 && test.Timeout == 0 && test.Expected == nil
+}
+
+// testTimeLimit gives the candidate's time limit on a test: its own
+// Timeout if it has one, or else the request's limit
+func (req *CommonRequest) testTimeLimit(test *testCase, ref *TestResult) time.Duration {
+	if test.Timeout > 0 {
+		return test.Timeout
+	}
+	return req.TimeLimit(ref)
+}
+
+// RunTest runs source, with its extra files and the support files, on
+// one test
+func (req *CommonRequest) RunTest(kind ProblemKind, test *testCase, source string, files FileSet, timeLimit time.Duration) (*TestResult, error) {
+	run, failed, err := req.setup(kind, test, source, files)
+	if err != nil || failed != nil {
+		return failed, err
+	}
+	defer os.RemoveAll(run.dir)
+
+	result, err := runSandbox(run.dir, run.args, run.stdin, timeLimit, run.maxMB, req.MaxOutputKB*1024)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.ExpectedFiles) > 0 {
+		result.Files = collectFiles(run.dir, req.ExpectedFiles, req.MaxOutputKB*1024)
+	}
+	return result, nil
+}
+
+// sandboxRun is a prepared but not yet launched run of a solution
+type sandboxRun struct {
+	dir   string
+	args  []string
+	stdin string
+	maxMB int
+}
+
+// setup creates a sandbox directory with everything needed to run
+// source on test. If the solution fails to compile, the compiler result
+// is returned instead. Otherwise the caller must remove the directory.
+func (req *CommonRequest) setup(kind ProblemKind, test *testCase, source string, files FileSet) (*sandboxRun, *TestResult, error) {
+	// create a sandbox directory
+	dirname, err := ioutil.TempDir("", "sandbox")
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to create working directory: %v", err)
+	}
+	run := &sandboxRun{dir: dirname}
+	ok := false
+	defer func() {
+		if !ok {
+			os.RemoveAll(dirname)
+		}
+	}()
+
+	// copy in the compiled solution, which includes the extra files
+	compiler, isCompiler := kind.(Compiler)
+	if isCompiler {
+		b, err := req.Build(kind, compiler, source, files, test.Input)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.result != nil {
+			return nil, b.result, nil
+		}
+		if err := copyDir(b.dir, dirname); err != nil {
+			return nil, nil, fmt.Errorf("Failed to copy compiled solution: %v", err)
+		}
+	}
+
+	// set up the environment files
+	if err := kind.Prepare(dirname, source, test.Input); err != nil {
+		return nil, nil, err
+	}
+	if !isCompiler {
+		if err := req.writeFiles(dirname, files); err != nil {
+			return nil, nil, err
+		}
+	}
+	args, stdin := kind.Command(req, source, test.Input)
+	run.args, run.stdin = commandLine(args, test.Args, test.Env), stdin
+	run.maxMB = req.MaxMB
+	if manager, isManager := kind.(MemoryManager); isManager {
+		run.maxMB = manager.SandboxMB(run.maxMB)
+	}
+
+	ok = true
+	return run, nil, nil
+}
+
+// writeFiles adds a solution's extra files and the read-only support
+// files to dir
+func (req *CommonRequest) writeFiles(dir string, files FileSet) error {
+	if err := files.Write(dir, 0644); err != nil {
+		return err
+	}
+	return req.SupportFiles.Write(dir, 0444)
+}
+
+// outcome holds the results of running one test against the
+// reference solution and, when grading, the candidate solution
+type outcome struct {
+	ref, cand       *TestResult
+	refErr, candErr error
+
+	// set when the request has a checker and both runs succeeded
+	verdict  *checkerVerdict
+	checkErr error
+
+	// expected files the candidate got wrong, when both runs succeeded
+	mismatches []*FileMismatch
+}
+
+// matched reports whether the candidate passed: its output matched and
+// so did any expected files
+func (out *outcome) matched(kind ProblemKind, req *CommonRequest) bool {
+	return out.outputMatched(kind, req) && len(out.mismatches) == 0
+}
+
+// outputMatched reports whether both runs succeeded and the checker
+// accepted the output or, without a checker, the kind judged the
+// outputs to match
+func (out *outcome) outputMatched(kind ProblemKind, req *CommonRequest) bool {
+	if out.ref.Error || out.cand.Error {
+		return false
+	}
+	if out.verdict != nil {
+		return out.verdict.Accepted
+	}
+	return kind.Compare(req, out.ref, out.cand)
+}
+
+// RunTests runs each test against the reference solution and, if
+// candidate is set, against the candidate solution. The runs proceed in
+// parallel, bounded by the worker pool, and the outcomes are returned
+// in test order. If progress is not nil, it is called (possibly
+// concurrently) with each test's index as soon as its outcome is
+// complete.
+func (req *CommonRequest) RunTests(kind ProblemKind, tests []*testCase, candidate bool, progress func(int, *outcome)) []*outcome {
+	outcomes := make([]*outcome, len(tests))
+	var wg sync.WaitGroup
+	for n, test := range tests {
+		out := new(outcome)
+		outcomes[n] = out
+
+		// with relative time limits, the candidate has to wait for
+		// the reference timing; pinned output has no timing
+		relative := candidate && req.relativeLimit(test)
+
+		wg.Add(1)
+		go func(n int, test *testCase) {
+			defer wg.Done()
+
+			var runs sync.WaitGroup
+			if candidate && !relative {
+				runs.Add(1)
+				go func() {
+					defer runs.Done()
+					out.cand, out.candErr = req.RunTest(kind, test, req.Candidate, req.CandidateFiles, req.testTimeLimit(test, nil))
+				}()
+			}
+			if test.Expected != nil {
+				out.ref = pinnedResult(*test.Expected)
+			} else {
+				out.ref, out.refErr = req.RunReferenceTest(kind, test, req.Reference, req.ReferenceFiles)
+			}
+			if relative && out.refErr == nil {
+				out.cand, out.candErr = req.RunTest(kind, test, req.Candidate, req.CandidateFiles, req.testTimeLimit(test, out.ref))
+			}
+			runs.Wait()
+
+			// run the checker and compare files on a pair of successful runs
+			if candidate && out.ref != nil && out.cand != nil && !out.ref.Error && !out.cand.Error {
+				if req.Checker != "" {
+					out.verdict, out.checkErr = req.RunChecker(test.Input, out.ref, out.cand)
+				}
+				if test.Expected == nil {
+					out.mismatches = req.CompareFiles(out.ref, out.cand)
+				}
+			}
+
+			if progress != nil {
+				progress(n, out)
+			}
+		}(n, test)
+	}
+	wg.Wait()
+
+	return outcomes
+}
+
+// decodeRequest reads and validates a request for the given problem kind.
+// On failure it reports the error to the client and returns nil.
+func decodeRequest(w http.ResponseWriter, decoder *json.Decoder, kind ProblemKind) *CommonRequest {
+	request := new(CommonRequest)
+	if err := decoder.Decode(request); err != nil {
+		log.Printf("Error decoding input: %v", err)
+		http.Error(w, fmt.Sprintf("Error decoding input: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	if err := request.Validate(); err != nil {
+		log.Printf("Error validating input: %v", err)
+		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	if err := kind.Validate(request); err != nil {
+		log.Printf("Error validating input: %v", err)
+		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	if err := request.validateReservedFiles(kind); err != nil {
+		log.Printf("Error validating input: %v", err)
+		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	return request
+}
+
+func grade_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, kind ProblemKind) {
+	request := decodeRequest(w, decoder, kind)
+	if request == nil {
+		return
+	}
+
+	response, err := request.Grade(kind, nil)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJson(w, r, response)
+}
+
+// Grade runs every test against the reference and candidate solutions
+// and reports the results. Errors are failures of the service itself,
+// not of the solutions being graded. If progress is not nil, it is
+// called (possibly concurrently) with each test's report as soon as the
+// test finishes; n indexes the public tests followed by the hidden ones.
+func (req *CommonRequest) Grade(kind ProblemKind, progress func(n int, report *TestReport)) (*GenericResponse, error) {
+	defer req.Cleanup()
+
+	response := &GenericResponse{
+		Report:  "",
+		Passed:  true,
+		Results: []*TestReport{},
+	}
+
+	// compiler output already included in the report
+	compilerErrors := make(map[string]bool)
+
+	// run everything up front, then report in order
+	all := append(append([]*testCase{}, req.cases...), req.hiddenCases...)
+	var finished func(int, *outcome)
+	if progress != nil {
+		finished = func(n int, out *outcome) {
+			// failures of the service are reported by Grade itself
+			if out.refErr != nil || out.candErr != nil || out.checkErr != nil {
+				return
+			}
+			progress(n, req.testReport(kind, n, out))
+		}
+	}
+	outcomes := req.RunTests(kind, all, true, finished)
+
+	passcount := 0
+	for n, test := range req.cases {
+		out := outcomes[n]
+
+		// the reference solution run
+		ref, err := out.ref, out.refErr
+		if err != nil {
+			return nil, fmt.Errorf("Error running reference solution %d: %v", n, err)
+		}
+
+		// the candidate solution run
+		cand, err := out.cand, out.candErr
+		if err != nil {
+			return nil, fmt.Errorf("Error running candidate solution %d: %v", n, err)
+		}
+		if out.checkErr != nil {
+			return nil, fmt.Errorf("Error running checker %d: %v", n, out.checkErr)
+		}
+
+		// report the result
+		if n > 0 {
+			response.Report += "\n-=-=-=-=-=-=-=-=-\n\n"
+		}
+
+		// record a pass or fail
+		matched := out.matched(kind, req)
+		result := req.testReport(kind, n, out)
+		response.Results = append(response.Results, result)
+		response.MaxScore += test.Weight
+		if !matched {
+			response.Report += fmt.Sprintf("%s: FAILED\n", req.testName(n))
+			response.Passed = false
+		} else {
+			response.Report += fmt.Sprintf("%s: PASSED\n", req.testName(n))
+			response.Score += test.Weight
+			passcount++
+		}
+
+		// give a few details
+		if ref.CompileError {
+			response.Report += compileReport("reference", ref, compilerErrors)
+		} else if ref.Error {
+			response.Report += fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
+			if ref.Stdout != "" {
+				response.Report += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", truncate(ref.Stdout, ResultOutputLimit))
+			}
+			if ref.Stderr != "" {
+				response.Report += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", truncate(ref.Stderr, ResultOutputLimit))
+			}
+		}
+		if cand.CompileError {
+			response.Report += compileReport("candidate", cand, compilerErrors)
+		} else if cand.Error {
+			response.Report += fmt.Sprintf("The candidate solution ended in error: %s\n", cand.Message)
+			if cand.Verdict.TimedOut() && req.relativeLimit(test) && !ref.Error {
+				response.Report += fmt.Sprintf("The time limit for this test was %.2f seconds, based on the reference solution's time of %.2f seconds\n",
+					cand.TimeLimit.Seconds(), ref.Elapsed.Seconds())
+			}
+			if cand.Stdout != "" {
+				response.Report += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", truncate(cand.Stdout, ResultOutputLimit))
+			}
+			if cand.Stderr != "" {
+				response.Report += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", truncate(cand.Stderr, ResultOutputLimit))
+			}
+		}
+		outputMatched := out.outputMatched(kind, req)
+		if out.verdict != nil && out.verdict.Error {
+			response.Report += "The checker ended in error\n"
+		} else if out.verdict != nil && !outputMatched {
+			response.Report += "The output was incorrect.\n\n"
+			if out.verdict.Message != "" {
+				response.Report += fmt.Sprintf("The checker reported:\n<<<<\n%s>>>>\n\n", truncate(out.verdict.Message, ResultOutputLimit))
+			}
+			response.Report += fmt.Sprintf("Your output was:\n<<<<\n%s>>>>\n", truncate(cand.Stdout, ResultOutputLimit))
+		} else if !ref.Error && !cand.Error && !outputMatched {
+			response.Report += "The output was incorrect.\n\n"
+			if result.FirstDifference == 0 {
+				response.Report += "The lines of your output match, but it differs in the final newline.\n"
+			} else {
+				response.Report += fmt.Sprintf("The first difference is on line %d of the correct output.\n\n"+
+					"Differences (- correct output, + your output):\n<<<<\n%s>>>>\n",
+					result.FirstDifference,
+					truncate(result.Diff, ResultOutputLimit))
+			}
+		}
+		if len(result.FileMismatches) > 0 {
+			response.Report += "\n" + fileReport(result.FileMismatches, false)
+		}
+	}
+	for n, test := range req.hiddenCases {
+		out := outcomes[len(req.cases)+n]
+
+		// the reference solution run
+		ref, err := out.ref, out.refErr
+		if err != nil {
+			return nil, fmt.Errorf("Error running reference solution on hidden %d: %v", n, err)
+		}
+
+		// the candidate solution run
+		cand, err := out.cand, out.candErr
+		if err != nil {
+			return nil, fmt.Errorf("Error running candidate solution on hidden %d: %v", n, err)
+		}
+		if out.checkErr != nil {
+			return nil, fmt.Errorf("Error running checker on hidden %d: %v", n, out.checkErr)
+		}
+
+		// report the result
+		response.Report += "\n-=-=-=-=-=-=-=-=-\n\n"
+
+		// record a pass or fail
+		matched := out.matched(kind, req)
+		response.Results = append(response.Results, req.testReport(kind, len(req.cases)+n, out))
+		response.MaxScore += test.Weight
+		if !matched {
+			response.Report += fmt.Sprintf("%s: FAILED\n", req.testName(len(req.cases)+n))
+			response.Passed = false
+		} else {
+			response.Report += fmt.Sprintf("%s: PASSED\n", req.testName(len(req.cases)+n))
+			response.Score += test.Weight
+			passcount++
+		}
+
+		// give a few details
+		if ref.CompileError {
+			response.Report += "The reference solution failed to compile\n"
+		} else if ref.Error {
+			response.Report += fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
+		}
+		if cand.CompileError {
+			response.Report += "The candidate solution failed to compile\n"
+		} else if cand.Error {
+			response.Report += fmt.Sprintf("The candidate solution ended in error: %s\n", cand.Message)
+		}
+		if out.verdict != nil && out.verdict.Error {
+			response.Report += "The checker ended in error\n"
+		} else if !ref.Error && !cand.Error && !out.outputMatched(kind, req) {
+			response.Report += "The output was incorrect.\n"
+		}
+		response.Report += fileReport(out.mismatches, true)
+	}
+	tests := len(all)
+	if tests == 1 {
+		log.Printf("  passed %d/%d test", passcount, tests)
+	} else {
+		log.Printf("  passed %d/%d tests", passcount, tests)
+	}
+
+	return response, nil
+}
+
+// testReport summarizes the outcome of test n, counting the public
+// tests first and then the hidden ones
+func (req *CommonRequest) testReport(kind ProblemKind, n int, out *outcome) *TestReport {
+	matched, outputMatched := out.matched(kind, req), out.outputMatched(kind, req)
+	if n < len(req.cases) {
+		return newTestReport(req.testName(n), false, req.cases[n].Weight, out, matched, outputMatched)
+	}
+	return newTestReport(req.testName(n), true, req.hiddenCases[n-len(req.cases)].Weight, out, matched, outputMatched)
+}
+
+// testName gives the name of test n, counting the public tests first
+// and then the hidden ones
+func (req *CommonRequest) testName(n int) string {
+	if n < len(req.cases) {
+		if req.cases[n].Name != "" {
+			return req.cases[n].Name
+		}
+		return fmt.Sprintf("Test #%d", n+1)
+	}
+	n -= len(req.cases)
+	if req.hiddenCases[n].Name != "" {
+		return req.hiddenCases[n].Name
+	}
+	return fmt.Sprintf("Hidden test #%d", n+1)
+}
+
+func output_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, kind ProblemKind) {
+	request := decodeRequest(w, decoder, kind)
+	if request == nil {
+		return
+	}
+	defer request.Cleanup()
+
+	results := []string{}
+
+	outcomes := request.RunTests(kind, request.cases, false, nil)
+	for n, out := range outcomes {
+		// the reference solution run
+		ref, err := out.ref, out.refErr
+		if err != nil {
+			log.Printf("Error running reference solution %d: %v", n, err)
+			http.Error(w, fmt.Sprintf("Error running reference solution %d: %v", n, err), http.StatusInternalServerError)
+			return
+		}
+
+		// give a few details
+		if ref.CompileError {
+			results = append(results, compileReport("reference", ref, nil))
+		} else if ref.Error {
+			msg := fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
+			if ref.Stdout != "" {
+				msg += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", ref.Stdout)
+			}
+			if ref.Stderr != "" {
+				msg += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", ref.Stderr)
+			}
+			results = append(results, msg)
+		} else {
+			results = append(results, ref.Stdout)
+		}
+	}
+
+	response := map[string][]string{"Output": results}
+
+	writeJson(w, r, response)
+}
+
+// compileReport describes a failed build. The compiler output is given
+// in its own section unless it is already recorded in shown.
+func compileReport(solution string, result *TestResult, shown map[string]bool) string {
+	msg := fmt.Sprintf("The %s solution failed to compile\n", solution)
+	output := result.Stdout + result.Stderr
+	if output == "" {
+		return msg + fmt.Sprintf("The compiler ended in error: %s\n", result.Message)
+	}
+	if shown[output] {
+		return msg + "See the compiler errors above\n"
+	}
+	if shown != nil {
+		shown[output] = true
+	}
+	return msg + fmt.Sprintf("\nCompiler errors:\n<<<<\n%s>>>>\n\n", truncate(output, ResultOutputLimit))
+}
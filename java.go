@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Java problems take the same fields as Python 2.7 stdin problems
+// with Java syntax for the source fields
+
+var JavaStdinDescription = &ProblemType{
+	Name:      "Java Stdin",
+	Tag:       "javastdin",
+	FieldList: withSourceType(Python27StdinDescription.FieldList, "python", "java"),
+}
+
+func init() {
+	RegisterKind(&javaKind{description: JavaStdinDescription})
+}
+
+// matches the declaration of a public top-level class
+var javaPublicClass = regexp.MustCompile(`\bpublic\s+(?:(?:final|abstract|strictfp)\s+)*class\s+([A-Za-z_$][A-Za-z0-9_$]*)`)
+
+// matches any class declaration
+var javaClass = regexp.MustCompile(`\bclass\s+([A-Za-z_$][A-Za-z0-9_$]*)`)
+
+// matches the declaration of a main method
+var javaMain = regexp.MustCompile(`\bstatic\s+(?:final\s+)?void\s+main\s*\(`)
+
+// javaClassName finds the class that should hold main: the public class
+// if there is one, otherwise the class declared last before the main
+// method, otherwise the first class declared. Comments and literals are
+// ignored.
+func javaClassName(source string) string {
+	source = javaCode(source)
+	if groups := javaPublicClass.FindStringSubmatch(source); groups != nil {
+		return groups[1]
+	}
+	classes := javaClass.FindAllStringSubmatchIndex(source, -1)
+	if len(classes) == 0 {
+		return "Main"
+	}
+	name := source[classes[0][2]:classes[0][3]]
+	if main := javaMain.FindStringIndex(source); main != nil {
+		for _, class := range classes {
+			if class[0] < main[0] {
+				name = source[class[2]:class[3]]
+			}
+		}
+	}
+	return name
+}
+
+// javaCode blanks out the comments and string and character literals
+// in Java source, keeping everything else in place
+func javaCode(source string) string {
+	code := []byte(source)
+	blank := func(from, to int) {
+		for i := from; i < to && i < len(code); i++ {
+			if code[i] != '\n' {
+				code[i] = ' '
+			}
+		}
+	}
+	for i := 0; i < len(code); i++ {
+		switch {
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				end = len(source) - i
+			}
+			blank(i, i+end)
+			i += end
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				end = len(source) - i
+			} else {
+				end += 4
+			}
+			blank(i, i+end)
+			i += end - 1
+		case strings.HasPrefix(source[i:], `"""`):
+			end := strings.Index(source[i+3:], `"""`)
+			if end < 0 {
+				end = len(source) - i
+			} else {
+				end += 6
+			}
+			blank(i, i+end)
+			i += end - 1
+		case source[i] == '"' || source[i] == '\'':
+			// a literal ends at its closing quote or, if unterminated,
+			// at the end of the line
+			j := i + 1
+			for j < len(source) && source[j] != source[i] && source[j] != '\n' {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			blank(i, j+1)
+			i = j
+		}
+	}
+	return string(code)
+}
+
+// javaKind compiles a single Java source file once per solution and
+// runs it with a fixed heap size. The JVM reserves far more address
+// space than it uses, so the sandbox limit is relaxed and the heap
+// limit enforces MaxMB instead.
+type javaKind struct {
+	description *ProblemType
+}
+
+func (kind *javaKind) Description() *ProblemType {
+	return kind.description
+}
+
+func (kind *javaKind) Validate(req *CommonRequest) error {
+	if code := javaCode(req.Reference); !javaPublicClass.MatchString(code) && !javaClass.MatchString(code) {
+		return fmt.Errorf("Reference solution must declare a class")
+	}
+	return nil
+}
+
+func (kind *javaKind) BuildPerTest() bool {
+	return false
+}
+
+func (kind *javaKind) PrepareBuild(dir, source, test string, extra []string) ([]string, error) {
+	filename := javaClassName(source) + ".java"
+	if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(source), 0644); err != nil {
+		return nil, fmt.Errorf("Failed to create %s file: %v", filename, err)
+	}
+	return []string{JavacPath,
+		"-J-Xmx" + strconv.Itoa(CompileMaxMB) + "m",
+		"-encoding", "UTF-8",
+		"-d", ".",
+		filename,
+	}, nil
+}
+
+func (kind *javaKind) ReservedFiles(source string) []string {
+	return []string{javaClassName(source) + ".java"}
+}
+
+func (kind *javaKind) SandboxMB(maxMB int) int {
+	return maxMB + JVMOverheadMB
+}
+
+func (kind *javaKind) VersionCommand() []string {
+	return []string{JavaPath, "-version"}
+}
+
+func (kind *javaKind) Prepare(dir, source, test string) error {
+	// everything needed was produced by the build
+	return nil
+}
+
+func (kind *javaKind) Command(req *CommonRequest, source, test string) ([]string, string) {
+	return []string{JavaPath,
+		"-Xmx" + strconv.Itoa(req.MaxMB) + "m",
+		"-XX:+UseSerialGC",
+		"-Xss64m",
+		"-cp", ".",
+		javaClassName(source),
+	}, test
+}
+
+func (kind *javaKind) Compare(req *CommonRequest, ref, cand *TestResult) bool {
+	return req.CompareOutput(ref.Stdout, cand.Stdout)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestJavaClassName(t *testing.T) {
+	tests := []struct {
+		source string
+		name   string
+	}{
+		{"public class Solution {\n  public static void main(String[] args) {}\n}\n", "Solution"},
+		{"public final class Solution {}\n", "Solution"},
+		{"class Main {\n  public static void main(String[] args) {}\n}\n", "Main"},
+		{"// my class solution\nclass Main {\n  public static void main(String[] args) {}\n}\n", "Main"},
+		{"/* public class Old */\nclass Main {}\n", "Main"},
+		{"/** the class Doc\n * public class Doc */\nclass Main {}\n", "Main"},
+		{"class Main {\n  String s = \"class Str\";\n  char c = '\"';\n  String t = \"public class Str\";\n}\n", "Main"},
+		{"class Helper {}\nclass Program {\n  public static void main(String[] args) {}\n}\n", "Program"},
+		{"class Helper {}\nclass Other {}\n", "Helper"},
+		{"int x;\n", "Main"},
+	}
+	for _, test := range tests {
+		if name := javaClassName(test.source); name != test.name {
+			t.Errorf("javaClassName(%q) = %q, want %q", test.source, name, test.name)
+		}
+	}
+}
+
+func TestJavaCode(t *testing.T) {
+	source := "a // b\nc /* d\ne */ f \"g\\\"h\" 'i' j"
+	want := "a     \nc     \n     f            j"
+	if code := javaCode(source); code != want {
+		t.Errorf("javaCode(%q) = %q, want %q", source, code, want)
+	}
+}
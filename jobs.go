@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// job states
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is an asynchronous grading request. Clients poll for it at
+// /jobs/<id>; if a callback URL was given, the finished job is also
+// posted there.
+type Job struct {
+	ID       string
+	Tag      string
+	Status   string
+	Created  time.Time
+	Started  *time.Time       `json:",omitempty"`
+	Finished *time.Time       `json:",omitempty"`
+	Error    string           `json:",omitempty"`
+	Result   *GenericResponse `json:",omitempty"`
+
+	kind     ProblemKind
+	request  *CommonRequest
+	callback string
+}
+
+// JobQueue runs grading jobs in the background with a fixed number of
+// workers, keeping finished jobs for the retention period.
+type JobQueue struct {
+	mutex     sync.Mutex
+	jobs      map[string]*Job
+	queue     chan *Job
+	retention time.Duration
+}
+
+// NewJobQueue starts a queue with the given number of workers
+func NewJobQueue(workers int, retention time.Duration) *JobQueue {
+	q := &JobQueue{
+		jobs:      make(map[string]*Job),
+		queue:     make(chan *Job, JobQueueLength),
+		retention: retention,
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	go q.expire()
+	return q
+}
+
+// Submit queues a validated request and returns a snapshot of the new job
+func (q *JobQueue) Submit(kind ProblemKind, request *CommonRequest, callback string) (*Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:       id,
+		Tag:      kind.Description().Tag,
+		Status:   JobQueued,
+		Created:  time.Now(),
+		kind:     kind,
+		request:  request,
+		callback: callback,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	select {
+	case q.queue <- job:
+	default:
+		return nil, fmt.Errorf("Job queue is full")
+	}
+	q.jobs[id] = job
+	return job.snapshot(), nil
+}
+
+// Get returns a snapshot of a job
+func (q *JobQueue) Get(id string) (*Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	job, present := q.jobs[id]
+	if !present {
+		return nil, false
+	}
+	return job.snapshot(), true
+}
+
+// snapshot copies the public fields of a job. The caller must hold the
+// queue mutex.
+func (job *Job) snapshot() *Job {
+	return &Job{
+		ID:       job.ID,
+		Tag:      job.Tag,
+		Status:   job.Status,
+		Created:  job.Created,
+		Started:  job.Started,
+		Finished: job.Finished,
+		Error:    job.Error,
+		Result:   job.Result,
+	}
+}
+
+func (q *JobQueue) worker() {
+	for job := range q.queue {
+		q.mutex.Lock()
+		started := time.Now()
+		job.Status = JobRunning
+		job.Started = &started
+		q.mutex.Unlock()
+
+		log.Printf("Job %s: grading %s", job.ID, job.Tag)
+		result, err := job.request.Grade(job.kind, nil)
+
+		q.mutex.Lock()
+		finished := time.Now()
+		job.Finished = &finished
+		if err != nil {
+			log.Printf("Job %s: %v", job.ID, err)
+			job.Status = JobFailed
+			job.Error = err.Error()
+		} else {
+			job.Status = JobDone
+			job.Result = result
+		}
+		job.request = nil
+		snapshot := job.snapshot()
+		q.mutex.Unlock()
+
+		// a slow or dead callback host must not hold up grading
+		if job.callback != "" {
+			go notify(job.callback, snapshot)
+		}
+	}
+}
+
+// expire drops finished jobs once they are past the retention period
+func (q *JobQueue) expire() {
+	for range time.Tick(time.Minute) {
+		q.mutex.Lock()
+		for id, job := range q.jobs {
+			if job.Finished != nil && time.Since(*job.Finished) > q.retention {
+				delete(q.jobs, id)
+			}
+		}
+		q.mutex.Unlock()
+	}
+}
+
+// Callbacks may only go to hosts the operator allows, and are signed
+// when a key is configured: the X-Signature header holds "sha256="
+// followed by the hex HMAC-SHA256 of the body. Both are set by main.
+var callbackHosts hostList
+var callbackKey []byte
+
+// SetCallbackConfig sets the comma-separated list of hosts, each a
+// host name or host:port, that callbacks may be posted to, and reads
+// the signing key from keyFile if it is not empty
+func SetCallbackConfig(hosts, keyFile string) error {
+	callbackHosts = parseHostList(hosts)
+	if keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		if callbackKey = bytes.TrimSpace(key); len(callbackKey) == 0 {
+			return fmt.Errorf("callback key file %s is empty", keyFile)
+		}
+	}
+	return nil
+}
+
+// redirects are not followed, since they could lead to any host
+var callbackClient = &http.Client{
+	Timeout: JobCallbackTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// notify posts a finished job to its callback URL, retrying a few times
+func notify(callback string, job *Job) {
+	raw, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Job %s: error encoding callback: %v", job.ID, err)
+		return
+	}
+	signature := ""
+	if len(callbackKey) > 0 {
+		mac := hmac.New(sha256.New, callbackKey)
+		mac.Write(raw)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	for attempt := 1; attempt <= JobCallbackAttempts; attempt++ {
+		req, err := http.NewRequest("POST", callback, bytes.NewReader(raw))
+		if err != nil {
+			log.Printf("Job %s: error creating callback: %v", job.ID, err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if signature != "" {
+			req.Header.Set("X-Signature", signature)
+		}
+		resp, err := callbackClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("callback returned %s", resp.Status)
+		}
+		log.Printf("Job %s: callback attempt %d failed: %v", job.ID, attempt, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func newJobID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("Failed to generate job ID: %v", err)
+	}
+	return fmt.Sprintf("%x", raw), nil
+}
+
+// validateCallback checks that a callback URL is an absolute http(s) URL
+// on an allowed host
+func validateCallback(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return fmt.Errorf("Invalid callback URL: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Callback URL must be an absolute http or https URL")
+	}
+	if !callbackHosts.Allows(u) {
+		return fmt.Errorf("Callback host %s is not allowed", u.Host)
+	}
+	return nil
+}
+
+// the queue used by the job handlers; created by main
+var jobs *JobQueue
+
+func job_submit_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, kind ProblemKind) {
+	callback := r.URL.Query().Get("callback")
+	if callback != "" {
+		if err := validateCallback(callback); err != nil {
+			log.Printf("%v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	request := decodeRequest(w, decoder, kind)
+	if request == nil {
+		return
+	}
+
+	job, err := jobs.Submit(kind, request, callback)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("  queued job %s", job.ID)
+
+	writeJson(w, r, job)
+}
+
+func job_status_handler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("%s %s", r.Method, r.URL)
+	if r.Method != "GET" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	job, present := jobs.Get(id)
+	if !present {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	writeJson(w, r, job)
+}
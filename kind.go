@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ProblemKind is implemented by each language backend. The generic
+// grade and output handlers use it to validate requests, set up the
+// sandbox directory, launch a test, and compare results.
+type ProblemKind interface {
+	// Description is the problem type advertised in /list
+	Description() *ProblemType
+
+	// Validate performs any language-specific checks on a request
+	// after the common fields have been validated
+	Validate(req *CommonRequest) error
+
+	// Prepare writes the files needed to run one test into dir
+	Prepare(dir, source, test string) error
+
+	// Command returns the command line to run inside the sandbox
+	// and the data to feed it on stdin
+	Command(req *CommonRequest, source, test string) (args []string, stdin string)
+
+	// Compare reports whether the candidate result matches the reference
+	// under the request's comparison settings
+	Compare(req *CommonRequest, ref, cand *TestResult) bool
+}
+
+// problem kinds in the order they were registered
+var problemKinds []ProblemKind
+
+// RegisterKind adds a backend to the registry. It should be called
+// from an init function; handlers are installed by main.
+func RegisterKind(kind ProblemKind) {
+	tag := kind.Description().Tag
+	for _, elt := range problemKinds {
+		if elt.Description().Tag == tag {
+			log.Fatalf("Problem kind %s registered twice", tag)
+		}
+	}
+	problemKinds = append(problemKinds, kind)
+}
+
+// ProblemTypes returns the descriptions of all registered backends
+func ProblemTypes() []*ProblemType {
+	lst := []*ProblemType{}
+	for _, kind := range problemKinds {
+		lst = append(lst, kind.Description())
+	}
+	return lst
+}
+
+// fields that hold solution or test driver code
+var sourceFields = map[string]bool{
+	"Reference":   true,
+	"Candidate":   true,
+	"Tests":       true,
+	"HiddenTests": true,
+
+	// the object form of a test
+	"Input": true,
+}
+
+// withSourceType returns a copy of fields with each source field of
+// type from changed to type to, including those within object fields
+func withSourceType(fields []ProblemField, from, to string) []ProblemField {
+	lst := make([]ProblemField, len(fields))
+	copy(lst, fields)
+	for i := range lst {
+		if sourceFields[lst[i].Name] && lst[i].Type == from {
+			lst[i].Type = to
+		}
+		if lst[i].Fields != nil {
+			lst[i].Fields = withSourceType(lst[i].Fields, from, to)
+		}
+	}
+	return lst
+}
+
+// withTitles returns a copy of fields with the titles of the named
+// fields replaced
+func withTitles(fields []ProblemField, titles map[string]string) []ProblemField {
+	lst := make([]ProblemField, len(fields))
+	copy(lst, fields)
+	for i := range lst {
+		if title, present := titles[lst[i].Name]; present {
+			lst[i].Title = title
+		}
+	}
+	return lst
+}
+
+// Compiler is implemented by kinds that must build a solution before
+// running it. The build runs in the sandbox under the compile limits,
+// and the files it leaves behind are copied into each test's directory
+// before Prepare is called.
+type Compiler interface {
+	// PrepareBuild writes the files needed to build source into dir
+	// and returns the compile command line. test is only passed to
+	// kinds that report BuildPerTest. extra lists the paths of the
+	// solution's extra files and the support files, which are written
+	// to dir after PrepareBuild returns.
+	PrepareBuild(dir, source, test string, extra []string) ([]string, error)
+
+	// BuildPerTest reports whether each test needs its own build,
+	// e.g., when the test is a driver linked against the solution
+	BuildPerTest() bool
+}
+
+// MemoryManager is implemented by kinds whose runtime enforces the
+// memory limit itself, e.g., with a JVM heap size. SandboxMB maps the
+// requested limit to the address space limit given to the sandbox.
+type MemoryManager interface {
+	SandboxMB(maxMB int) int
+}
+
+// FileReserver is implemented by kinds that write files of their own
+// into the sandbox directory. ReservedFiles lists the paths they use to
+// build and run source, which extra files must not take.
+type FileReserver interface {
+	ReservedFiles(source string) []string
+}
+
+// Versioned is implemented by kinds whose results depend on an
+// installed toolchain. VersionCommand reports its version; the output
+// is folded into reference result signatures so that persisted results
+// are not reused after an upgrade.
+type Versioned interface {
+	VersionCommand() []string
+}
+
+var versions = make(map[string]string)
+var versionsMutex sync.Mutex
+
+// kindVersion runs the kind's version command once and remembers the
+// result. Kinds that do not report a version get an empty string.
+func kindVersion(kind ProblemKind) string {
+	versioned, ok := kind.(Versioned)
+	if !ok {
+		return ""
+	}
+	args := versioned.VersionCommand()
+	key := strings.Join(args, " ")
+
+	versionsMutex.Lock()
+	defer versionsMutex.Unlock()
+	if version, present := versions[key]; present {
+		return version
+	}
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	version := string(bytes.TrimSpace(out))
+	if err != nil {
+		log.Printf("Error getting version with %s: %v", key, err)
+		version = "unknown: " + err.Error()
+	}
+	versions[key] = version
+	return version
+}
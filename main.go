@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -30,41 +34,114 @@ type ProblemField struct {
 	Student string
 	Grader  string
 	Result  string
+
+	// for list fields whose entries may also be objects, the fields of
+	// those objects
+	Fields []ProblemField `json:",omitempty"`
 }
 
 type GenericResponse struct {
-	Report string
-	Passed bool
+	Report   string
+	Passed   bool
+	Score    int
+	MaxScore int
+	Results  []*TestReport
 }
 
 type TestResult struct {
-	Error   bool
-	Message string
-	Stdout  string
-	Stderr  string
+	Error        bool
+	CompileError bool
+	Verdict      Verdict
+	ExitCode     int
+	Message      string
+	Stdout       string
+	Stderr       string
+	Elapsed      time.Duration
+	Usage        ResourceUsage
+	TimeLimit    time.Duration
+
+	// the contents of the expected files the run left behind
+	Files map[string]string `json:",omitempty"`
 }
 
 const (
-	DefaultAddress       = ":8081"
-	CompressionThreshold = 1024
-	Python27Name         = "/usr/local/bin/python2.7-static"
-	SandboxName          = "/usr/local/bin/sandbox"
-	LogFileName          = "/var/log/sandbox/sandboxservice.log"
-	MaxMB                = 256
-	MaxSeconds           = 60
-	JSONIndent           = true
+	DefaultAddress        = ":8081"
+	CompressionThreshold  = 1024
+	Python27Name          = "/usr/local/bin/python2.7-static"
+	Python3Name           = "/usr/bin/python3"
+	GCCName               = "/usr/bin/gcc"
+	GPPName               = "/usr/bin/g++"
+	JavacName             = "/usr/bin/javac"
+	JavaName              = "/usr/bin/java"
+	GoName                = "/usr/local/go/bin/go"
+	GoCacheName           = "/usr/local/lib/gocache"
+	SandboxName           = "/usr/local/bin/sandbox"
+	LogFileName           = "/var/log/sandbox/sandboxservice.log"
+	MaxMB                 = 256
+	MaxSeconds            = 60
+	CompileMaxMB          = 256
+	CompileMaxSeconds     = 30
+	CheckerMaxMB          = 256
+	CheckerMaxSeconds     = 10
+	DefaultMinSeconds     = 1.0
+	JVMOverheadMB         = 1024
+	GoOverheadMB          = 256
+	DefaultCacheEntries   = 10000
+	DefaultCacheMB        = 8
+	DefaultDiskCacheMB    = 1024
+	DefaultMaxOutputKB    = 1024
+	ResultOutputLimit     = 4096
+	DefaultEpsilon        = 1e-6
+	DiffContext           = 3
+	DiffMaxLines          = 100
+	DiffMaxCells          = 1 << 18
+	JobQueueLength        = 1000
+	JobCallbackAttempts   = 3
+	JobCallbackTimeout    = 10 * time.Second
+	DefaultJobWorkers     = 2
+	DefaultJobRetention   = time.Hour
+	MaxFiles              = 100
+	MaxFilesKB            = 4096
+	MaxTestArgs           = 100
+	MaxTestArgsKB         = 64
+	SessionIdleTimeout    = 30 * time.Second
+	WebSocketMaxMessage   = 1 << 20
+	WebSocketWriteTimeout = 10 * time.Second
+	JSONIndent            = true
 )
 
 var Python27Path string
+var Python3Path string
+var GCCPath string
+var GPPPath string
+var JavacPath string
+var JavaPath string
+var GoPath string
+var GoCachePath string
 var SandboxPath string
 
+// upper limit on MaxOutputKB, and the default when a problem does not set it
+var MaxOutputKB = DefaultMaxOutputKB
+
 func main() {
-	if len(os.Args) > 2 {
-		log.Fatalf("Usage: %s [[address]:port]", os.Args[0])
+	workers := flag.Int("workers", runtime.NumCPU(), "maximum number of sandboxed processes to run at once")
+	cacheEntries := flag.Int("cache-entries", DefaultCacheEntries, "maximum number of reference results to cache")
+	cacheMB := flag.Int("cache-mb", DefaultCacheMB, "maximum size of the reference result cache in megabytes")
+	maxOutputKB := flag.Int("max-output-kb", DefaultMaxOutputKB, "maximum output captured from each of stdout and stderr in kilobytes")
+	jobWorkers := flag.Int("job-workers", DefaultJobWorkers, "number of asynchronous grading jobs to run at once")
+	jobRetention := flag.Duration("job-retention", DefaultJobRetention, "how long to keep finished asynchronous jobs")
+	cacheDir := flag.String("cache-dir", "", "directory to persist reference results in (disabled if empty)")
+	cacheDirMB := flag.Int("cache-dir-mb", DefaultDiskCacheMB, "maximum size of the persistent reference result cache in megabytes")
+	callbackHosts := flag.String("callback-hosts", "", "comma-separated hosts that job callbacks may be posted to (callbacks refused if empty)")
+	callbackKeyFile := flag.String("callback-key-file", "", "file holding the key used to sign job callbacks (unsigned if empty)")
+	sessionOrigins := flag.String("session-origins", "", "comma-separated hosts whose web pages may open sessions, besides the service's own")
+	flag.Parse()
+	if flag.NArg() > 1 || *workers < 1 || *cacheEntries < 1 || *cacheMB < 1 || *cacheDirMB < 1 || *maxOutputKB < 1 || *jobWorkers < 1 {
+		log.Fatalf("Usage: %s [options] [[address]:port]", os.Args[0])
 	}
 	address := DefaultAddress
-	if len(os.Args) == 2 {
-		address = os.Args[1]
+	if flag.NArg() == 1 {
+		address = flag.Arg(0)
 	}
 
 	// set log file
@@ -76,18 +153,49 @@ func main() {
 	log.SetOutput(logfile)
 
 	Python27Path = Python27Name
+	Python3Path = Python3Name
+	GCCPath = GCCName
+	GPPPath = GPPName
+	JavacPath = JavacName
+	JavaPath = JavaName
+	GoPath = GoName
+	GoCachePath = GoCacheName
+	if exists, err := fileExists(GoCachePath); err != nil || !exists {
+		log.Printf("Go build cache %s not found; Go solutions will build slowly", GoCachePath)
+	}
 	SandboxPath = SandboxName
+	SetWorkers(*workers)
+	MaxOutputKB = *maxOutputKB
+	var store *DiskStore
+	if *cacheDir != "" {
+		if store, err = NewDiskStore(*cacheDir, int64(*cacheDirMB)<<20); err != nil {
+			log.Fatalf("Failed to open disk cache %s: %v", *cacheDir, err)
+		}
+	}
+	cache = NewResultCache(*cacheEntries, int64(*cacheMB)<<20, store)
+	if err := SetCallbackConfig(*callbackHosts, *callbackKeyFile); err != nil {
+		log.Fatalf("Failed to configure job callbacks: %v", err)
+	}
+	jobs = NewJobQueue(*jobWorkers, *jobRetention)
+	allowedOrigins = parseHostList(*sessionOrigins)
 
-	http.Handle("/grade/python27stdin", jsonHandler(python27stdin_handler))
-	http.Handle("/grade/python27module", jsonHandler(python27module_handler))
-	http.Handle("/output/python27stdin", jsonHandler(python27stdin_output_handler))
-	http.Handle("/output/python27module", jsonHandler(python27module_output_handler))
+	for _, kind := range problemKinds {
+		tag := kind.Description().Tag
+		http.Handle("/grade/"+tag, kindHandler(kind, grade_handler))
+		http.Handle("/output/"+tag, kindHandler(kind, output_handler))
+		http.Handle("/run/"+tag, kindHandler(kind, run_handler))
+		http.Handle("/jobs/grade/"+tag, kindHandler(kind, job_submit_handler))
+		http.Handle("/stream/grade/"+tag, streamHandler(kind))
+		http.Handle("/session/"+tag, sessionHandler(kind))
+	}
+	http.HandleFunc("/jobs/", job_status_handler)
 	http.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("%s %s", r.Method, r.URL)
-		writeJson(w, r, []*ProblemType{
-			Python27StdinDescription,
-			Python27ModuleDescription,
-		})
+		writeJson(w, r, ProblemTypes())
+	})
+	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		writeJson(w, r, map[string]CacheStats{"Cache": cache.Stats()})
 	})
 
 	log.Printf("Listening on %s", address)
@@ -107,6 +215,26 @@ func fileExists(path string) (bool, error) {
 	return false, err
 }
 
+// hostList is a set of host names and host:port pairs, all lower case
+type hostList map[string]bool
+
+// parseHostList parses a comma-separated list of hosts
+func parseHostList(list string) hostList {
+	hosts := make(hostList)
+	for _, host := range strings.Split(list, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return hosts
+}
+
+// Allows reports whether the host of u is in the list, either by name
+// alone or with its port
+func (hosts hostList) Allows(u *url.URL) bool {
+	return hosts[strings.ToLower(u.Host)] || hosts[strings.ToLower(u.Hostname())]
+}
+
 func fixLineEndings(s string) string {
 	s = strings.Replace(s, "\r\n", "\n", -1)
 	if !strings.HasSuffix(s, "\n") {
@@ -132,27 +260,44 @@ type jsonHandler func(http.ResponseWriter, *http.Request, *json.Decoder)
 func (h jsonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Printf("%s %s", r.Method, r.URL)
 	start := time.Now()
+	if !checkJSONRequest(w, r, "application/json") {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+
+	h(w, r, decoder)
+	log.Printf("  request completed in %v", time.Since(start))
+}
+
+// checkJSONRequest verifies that r is a POST with a JSON body from a
+// client that accepts responses of the given content type. On failure
+// it reports the error to the client and returns false.
+func checkJSONRequest(w http.ResponseWriter, r *http.Request, accept string) bool {
 	if r.Method != "POST" {
 		log.Printf("JSON request called with method %s", r.Method)
 		http.Error(w, "Not found", http.StatusNotFound)
-		return
+		return false
 	}
 	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
 		log.Printf("JSON request called with Content-Type %s", r.Header.Get("Content-Type"))
 		http.Error(w, "Request must be in JSON format; must include Content-Type: application/json in request", http.StatusBadRequest)
-		return
+		return false
 	}
-	if !strings.Contains(r.Header.Get("Accept"), "application/json") && !strings.Contains(r.Header.Get("Accept"), "*/*") {
-		log.Printf("Client does not accept application/json; Accept is %s", r.Header.Get("Accept"))
-		http.Error(w, "Client does not accept JSON response; must include Accept: application/json in request", http.StatusBadRequest)
-		return
+	if !strings.Contains(r.Header.Get("Accept"), accept) && !strings.Contains(r.Header.Get("Accept"), "*/*") {
+		log.Printf("Client does not accept %s; Accept is %s", accept, r.Header.Get("Accept"))
+		http.Error(w, fmt.Sprintf("Client does not accept %s response; must include Accept: %s in request", accept, accept), http.StatusBadRequest)
+		return false
 	}
+	return true
+}
 
-	decoder := json.NewDecoder(r.Body)
-	defer r.Body.Close()
-
-	h(w, r, decoder)
-	log.Printf("  request completed in %v", time.Since(start))
+// kindHandler binds a generic handler to a single problem kind
+func kindHandler(kind ProblemKind, h func(http.ResponseWriter, *http.Request, *json.Decoder, ProblemKind)) jsonHandler {
+	return func(w http.ResponseWriter, r *http.Request, decoder *json.Decoder) {
+		h(w, r, decoder, kind)
+	}
 }
 
 func writeJson(w http.ResponseWriter, r *http.Request, elt interface{}) {
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// expected file mismatch kinds
+const (
+	FileMissing    = "missing"
+	FileUnexpected = "unexpected"
+	FileDifferent  = "different"
+)
+
+// FileMismatch describes an expected file that the candidate got wrong:
+// it did not create a file the reference did, created one the reference
+// did not, or wrote different contents. Diff and FirstDifference are as
+// in TestReport, and only filled in for public tests.
+type FileMismatch struct {
+	Path            string
+	Status          string
+	Diff            string
+	FirstDifference int
+}
+
+// validateExpectedFiles checks the list of files to collect after each run
+func (elt *CommonRequest) validateExpectedFiles() error {
+	if len(elt.ExpectedFiles) > MaxFiles {
+		return fmt.Errorf("ExpectedFiles must have at most %d files", MaxFiles)
+	}
+	seen := make(map[string]bool)
+	for _, p := range elt.ExpectedFiles {
+		if err := validatePath(p); err != nil {
+			return fmt.Errorf("ExpectedFiles: %v", err)
+		}
+		if seen[p] {
+			return fmt.Errorf("ExpectedFiles lists %s twice", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+// collectFiles reads the expected files a run left in dir, keeping at
+// most limit bytes of each. Files that are missing, are not regular
+// files, or are reached through a symbolic link are left out.
+func collectFiles(dir string, paths []string, limit int) map[string]string {
+	files := make(map[string]string)
+	for _, p := range paths {
+		if contents, ok := readSandboxFile(dir, p, limit); ok {
+			files[p] = contents
+		}
+	}
+	return files
+}
+
+func readSandboxFile(dir, p string, limit int) (string, bool) {
+	// the program controls the directory, so refuse to follow links
+	// out of it
+	name := dir
+	var info os.FileInfo
+	for _, part := range strings.Split(p, "/") {
+		name = filepath.Join(name, part)
+		var err error
+		info, err = os.Lstat(name)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return "", false
+		}
+	}
+
+	// opening a FIFO or device could block forever, so only regular
+	// files are opened, and without waiting in case one is swapped in
+	if !info.Mode().IsRegular() {
+		return "", false
+	}
+	fp, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return "", false
+	}
+	defer fp.Close()
+	if info, err := fp.Stat(); err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	raw, err := ioutil.ReadAll(io.LimitReader(fp, int64(limit)))
+	if err != nil {
+		return "", false
+	}
+	return string(raw), true
+}
+
+// CompareFiles checks each expected file from the candidate's run
+// against the reference run's, using the same rules as stdout
+func (req *CommonRequest) CompareFiles(ref, cand *TestResult) []*FileMismatch {
+	var mismatches []*FileMismatch
+	for _, p := range req.ExpectedFiles {
+		want, wantOK := ref.Files[p]
+		got, gotOK := cand.Files[p]
+		switch {
+		case !wantOK && !gotOK:
+		case !gotOK:
+			mismatches = append(mismatches, &FileMismatch{Path: p, Status: FileMissing})
+		case !wantOK:
+			mismatches = append(mismatches, &FileMismatch{Path: p, Status: FileUnexpected})
+		case !req.CompareOutput(want, got):
+			mismatches = append(mismatches, &FileMismatch{Path: p, Status: FileDifferent})
+		}
+	}
+	return mismatches
+}
+
+// fileReport describes the file mismatches of a test
+func fileReport(mismatches []*FileMismatch, hidden bool) string {
+	msg := ""
+	for _, m := range mismatches {
+		switch {
+		case m.Status == FileMissing:
+			msg += fmt.Sprintf("The file %s was not created.\n", m.Path)
+		case m.Status == FileUnexpected:
+			msg += fmt.Sprintf("The file %s should not have been created.\n", m.Path)
+		case hidden:
+			msg += fmt.Sprintf("The file %s was incorrect.\n", m.Path)
+		case m.FirstDifference == 0:
+			msg += fmt.Sprintf("The file %s was incorrect. Its lines match, but it differs in the final newline.\n", m.Path)
+		default:
+			msg += fmt.Sprintf("The file %s was incorrect. The first difference is on line %d of the correct file.\n\n"+
+				"Differences (- correct file, + your file):\n<<<<\n%s>>>>\n",
+				m.Path, m.FirstDifference, truncate(m.Diff, ResultOutputLimit))
+		}
+	}
+	return msg
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestCollectFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outside := filepath.Join(dir, "outside.txt")
+	sandbox := filepath.Join(dir, "sandbox")
+	for _, name := range []string{outside, filepath.Join(sandbox, "sub", "out.txt"), filepath.Join(sandbox, "big.txt")} {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := ioutil.WriteFile(name, []byte("contents"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(outside, filepath.Join(sandbox, "link.txt"))
+	os.Symlink(filepath.Join(sandbox, "sub"), filepath.Join(sandbox, "linkdir"))
+	os.Mkdir(filepath.Join(sandbox, "dir"), 0755)
+	if err := syscall.Mkfifo(filepath.Join(sandbox, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a FIFO must be skipped, not opened, or this would block forever
+	files := collectFiles(sandbox, []string{"sub/out.txt", "big.txt", "missing.txt", "link.txt", "linkdir/out.txt", "dir", "fifo"}, 3)
+	want := map[string]string{"sub/out.txt": "con", "big.txt": "con"}
+	if len(files) != len(want) {
+		t.Errorf("collectFiles = %q, want %q", files, want)
+	}
+	for p, contents := range want {
+		if files[p] != contents {
+			t.Errorf("collectFiles = %q, want %q", files, want)
+		}
+	}
+}
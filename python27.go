@@ -1,25 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha1"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"net/http"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
-	"strings"
-	"time"
 )
 
-// maps hash of testtype:referencesolution:testdata to *TestResult
-// only used for reference solutions
-var cache = make(map[string]*TestResult)
-
 var Python27ModuleDescription = &ProblemType{
 	Name: "Python 2.7 Module",
 	Tag:  "python27module",
@@ -80,6 +66,7 @@ var Python27ModuleDescription = &ProblemType{
 			Title:   "This code will run and will access your code as the 'Candidate' module",
 			Type:    "python",
 			List:    true,
+			Fields:  testFields("python"),
 			Creator: "edit",
 			Student: "view",
 			Grader:  "view",
@@ -102,6 +89,148 @@ var Python27ModuleDescription = &ProblemType{
 			Title:   "This code will also run and access your code as the 'Candidate' module",
 			Type:    "python",
 			List:    true,
+			Fields:  testFields("python"),
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Weights",
+			Prompt:  "Test weights",
+			Title:   "Points awarded for passing each test",
+			Type:    "int",
+			List:    true,
+			Default: "1",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenWeights",
+			Prompt:  "Hidden test weights",
+			Title:   "Points awarded for passing each hidden test",
+			Type:    "int",
+			List:    true,
+			Default: "1",
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Args",
+			Prompt:  "Test arguments",
+			Title:   "Command line arguments given to the solution on each test",
+			Type:    "args",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenArgs",
+			Prompt:  "Hidden test arguments",
+			Title:   "Command line arguments given to the solution on each hidden test",
+			Type:    "args",
+			List:    true,
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Env",
+			Prompt:  "Test environment",
+			Title:   "Environment variables set for the solution on each test",
+			Type:    "env",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenEnv",
+			Prompt:  "Hidden test environment",
+			Title:   "Environment variables set for the solution on each hidden test",
+			Type:    "env",
+			List:    true,
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "ReferenceFiles",
+			Prompt:  "Reference solution files",
+			Title:   "Extra files for the reference solution, by path; binary files may be given in base64",
+			Type:    "files",
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "CandidateFiles",
+			Prompt:  "Your solution files",
+			Title:   "Extra files for your solution, by path; binary files may be given in base64",
+			Type:    "files",
+			Creator: "nothing",
+			Student: "edit",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "SupportFiles",
+			Prompt:  "Support files",
+			Title:   "Read-only data files and helper modules provided to every run, by path",
+			Type:    "files",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "ExpectedFiles",
+			Prompt:  "Expected output files",
+			Title:   "Files each run must write, by path; they are compared with the reference solution's files like the output",
+			Type:    "text",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Compare",
+			Prompt:  "Output comparison",
+			Title:   "How output is compared: exact, ignore-whitespace, ignore-case, token, numeric, or unordered-lines",
+			Type:    "text",
+			Default: "exact",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Epsilon",
+			Prompt:  "Numeric tolerance",
+			Title:   "For numeric comparison, the absolute or relative difference permitted between numbers",
+			Type:    "float",
+			Default: "0.000001",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Checker",
+			Prompt:  "Output checker",
+			Title:   "Optional Python 3 script run as checker.py input.txt expected.txt output.txt; exit 0 to accept, 42 to reject",
+			Type:    "python",
 			Creator: "edit",
 			Student: "nothing",
 			Grader:  "view",
@@ -118,6 +247,28 @@ var Python27ModuleDescription = &ProblemType{
 			Grader:  "view",
 			Result:  "view",
 		},
+		{
+			Name:    "TimeMultiplier",
+			Prompt:  "Time limit as a multiple of the reference solution's time",
+			Title:   "If set, the time permitted on each test is this multiple of the reference solution's time, between MinSeconds and MaxSeconds",
+			Type:    "float",
+			Default: "0",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "MinSeconds",
+			Prompt:  "Min time permitted in seconds",
+			Title:   "The smallest time limit permitted when using TimeMultiplier",
+			Type:    "float",
+			Default: "1",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
 		{
 			Name:    "MaxMB",
 			Prompt:  "Max memory permitted in megabytes",
@@ -129,6 +280,17 @@ var Python27ModuleDescription = &ProblemType{
 			Grader:  "view",
 			Result:  "view",
 		},
+		{
+			Name:    "MaxOutputKB",
+			Prompt:  "Max output permitted in kilobytes",
+			Title:   "Max output permitted on each of stdout and stderr in kilobytes",
+			Type:    "int",
+			Default: "1024",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
 	},
 }
 
@@ -192,6 +354,7 @@ var Python27StdinDescription = &ProblemType{
 			Title:   "This data will be given to you via Stdin",
 			Type:    "text",
 			List:    true,
+			Fields:  testFields("text"),
 			Creator: "edit",
 			Student: "view",
 			Grader:  "view",
@@ -214,6 +377,148 @@ var Python27StdinDescription = &ProblemType{
 			Title:   "This data will also be given to you via Stdin",
 			Type:    "text",
 			List:    true,
+			Fields:  testFields("text"),
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Weights",
+			Prompt:  "Test weights",
+			Title:   "Points awarded for passing each test",
+			Type:    "int",
+			List:    true,
+			Default: "1",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenWeights",
+			Prompt:  "Hidden test weights",
+			Title:   "Points awarded for passing each hidden test",
+			Type:    "int",
+			List:    true,
+			Default: "1",
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Args",
+			Prompt:  "Test arguments",
+			Title:   "Command line arguments given to the solution on each test",
+			Type:    "args",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenArgs",
+			Prompt:  "Hidden test arguments",
+			Title:   "Command line arguments given to the solution on each hidden test",
+			Type:    "args",
+			List:    true,
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "Env",
+			Prompt:  "Test environment",
+			Title:   "Environment variables set for the solution on each test",
+			Type:    "env",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "HiddenEnv",
+			Prompt:  "Hidden test environment",
+			Title:   "Environment variables set for the solution on each hidden test",
+			Type:    "env",
+			List:    true,
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "ReferenceFiles",
+			Prompt:  "Reference solution files",
+			Title:   "Extra files for the reference solution, by path; binary files may be given in base64",
+			Type:    "files",
+			Creator: "edit",
+			Student: "nothing",
+			Grader:  "view",
+			Result:  "nothing",
+		},
+		{
+			Name:    "CandidateFiles",
+			Prompt:  "Your solution files",
+			Title:   "Extra files for your solution, by path; binary files may be given in base64",
+			Type:    "files",
+			Creator: "nothing",
+			Student: "edit",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "SupportFiles",
+			Prompt:  "Support files",
+			Title:   "Read-only data files and helper modules provided to every run, by path",
+			Type:    "files",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "ExpectedFiles",
+			Prompt:  "Expected output files",
+			Title:   "Files each run must write, by path; they are compared with the reference solution's files like the output",
+			Type:    "text",
+			List:    true,
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Compare",
+			Prompt:  "Output comparison",
+			Title:   "How output is compared: exact, ignore-whitespace, ignore-case, token, numeric, or unordered-lines",
+			Type:    "text",
+			Default: "exact",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Epsilon",
+			Prompt:  "Numeric tolerance",
+			Title:   "For numeric comparison, the absolute or relative difference permitted between numbers",
+			Type:    "float",
+			Default: "0.000001",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "Checker",
+			Prompt:  "Output checker",
+			Title:   "Optional Python 3 script run as checker.py input.txt expected.txt output.txt; exit 0 to accept, 42 to reject",
+			Type:    "python",
 			Creator: "edit",
 			Student: "nothing",
 			Grader:  "view",
@@ -230,6 +535,28 @@ var Python27StdinDescription = &ProblemType{
 			Grader:  "view",
 			Result:  "view",
 		},
+		{
+			Name:    "TimeMultiplier",
+			Prompt:  "Time limit as a multiple of the reference solution's time",
+			Title:   "If set, the time permitted on each test is this multiple of the reference solution's time, between MinSeconds and MaxSeconds",
+			Type:    "float",
+			Default: "0",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
+		{
+			Name:    "MinSeconds",
+			Prompt:  "Min time permitted in seconds",
+			Title:   "The smallest time limit permitted when using TimeMultiplier",
+			Type:    "float",
+			Default: "1",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
 		{
 			Name:    "MaxMB",
 			Prompt:  "Max memory permitted in megabytes",
@@ -241,355 +568,82 @@ var Python27StdinDescription = &ProblemType{
 			Grader:  "view",
 			Result:  "view",
 		},
+		{
+			Name:    "MaxOutputKB",
+			Prompt:  "Max output permitted in kilobytes",
+			Title:   "Max output permitted on each of stdout and stderr in kilobytes",
+			Type:    "int",
+			Default: "1024",
+			Creator: "edit",
+			Student: "view",
+			Grader:  "view",
+			Result:  "view",
+		},
 	},
 }
 
-type Python27CommonRequest struct {
-	Reference   string
-	Candidate   string
-	Tests       []string
-	HiddenTests []string
-	MaxSeconds  int
-	MaxMB       int
+func init() {
+	RegisterKind(&pythonKind{description: Python27StdinDescription, interpreter: &Python27Path, isModule: false})
+	RegisterKind(&pythonKind{description: Python27ModuleDescription, interpreter: &Python27Path, isModule: true})
 }
 
-func (elt *Python27CommonRequest) Validate() error {
-	// check Reference solution
-	elt.Reference = fixLineEndings(elt.Reference)
-	if isEmpty(elt.Reference) {
-		return fmt.Errorf("Reference solution is required")
-	}
-
-	// check Candidate solution
-	elt.Candidate = fixLineEndings(elt.Candidate)
-
-	// check Test list
-	lst := []string{}
-	for _, test := range elt.Tests {
-		test = fixLineEndings(test)
-		if !isEmpty(test) {
-			lst = append(lst, test)
-		}
-	}
-	elt.Tests = lst
-	if len(elt.Tests) == 0 {
-		return fmt.Errorf("Tests list must not be empty")
-	}
-
-	// check HiddenTest list
-	lst = []string{}
-	for _, test := range elt.HiddenTests {
-		test = fixLineEndings(test)
-		if !isEmpty(test) {
-			lst = append(lst, test)
-		}
-	}
-	elt.HiddenTests = lst
-
-	// check MaxSeconds
-	if elt.MaxSeconds < 1 {
-		return fmt.Errorf("MaxSeconds must be >= 1")
-	} else if elt.MaxSeconds > MaxSeconds {
-		return fmt.Errorf("MaxSeconds must be <= %d", MaxSeconds)
-	}
+// pythonKind runs Python code either as a stdin-driven script
+// or as the Candidate module imported by a test driver.
+// interpreter points at the path variable set up by main, and env
+// lists environment variables the interpreter needs.
+type pythonKind struct {
+	description *ProblemType
+	interpreter *string
+	env         []string
+	isModule    bool
+}
 
-	// check MaxMB
-	if elt.MaxMB < 1 {
-		return fmt.Errorf("MaxMB must be >= 1")
-	} else if elt.MaxMB > MaxMB {
-		return fmt.Errorf("MaxMB must be <= %d", MaxMB)
-	}
+func (kind *pythonKind) Description() *ProblemType {
+	return kind.description
+}
 
+func (kind *pythonKind) Validate(req *CommonRequest) error {
 	return nil
 }
 
-func (req *Python27CommonRequest) RunReferenceTest(test, source string, isModule bool) (*TestResult, error) {
-	// create a signature
-	h := sha1.New()
-	if isModule {
-		fmt.Fprintf(h, "python27module")
-	} else {
-		fmt.Fprintf(h, "python27stdin")
-	}
-	fmt.Fprintf(h, "\ue000%s\ue000%s", source, test)
-	key := fmt.Sprintf("%x", h.Sum(nil))
-	if result, present := cache[key]; present {
-		return result, nil
-	}
-	result, err := req.RunTest(test, source, isModule)
-	if err == nil {
-		cache[key] = result
-	}
-	return result, err
+func (kind *pythonKind) VersionCommand() []string {
+	return []string{*kind.interpreter, "--version"}
 }
 
-func (req *Python27CommonRequest) RunTest(test, source string, isModule bool) (*TestResult, error) {
-	// create a sandbox directory
-	dirname, err := ioutil.TempDir("", "sandbox")
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create working directory: %v", err)
+func (kind *pythonKind) ReservedFiles(source string) []string {
+	if kind.isModule {
+		return []string{"main.py", "Candidate.py"}
 	}
-	defer os.RemoveAll(dirname)
+	return []string{"main.py"}
+}
 
-	// set up the environment files
-	stdinData := ""
-	if !isModule {
-		stdinData = test
-	}
-	stdin := strings.NewReader(stdinData)
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	if isModule {
-		if err := ioutil.WriteFile(filepath.Join(dirname, "main.py"), []byte(test), 0644); err != nil {
-			return nil, fmt.Errorf("Failed to create main.py file: %v", err)
+func (kind *pythonKind) Prepare(dir, source, test string) error {
+	if kind.isModule {
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.py"), []byte(test), 0644); err != nil {
+			return fmt.Errorf("Failed to create main.py file: %v", err)
 		}
-		if err := ioutil.WriteFile(filepath.Join(dirname, "Candidate.py"), []byte(source), 0644); err != nil {
-			return nil, fmt.Errorf("Failed to create Candidate.py file: %v", err)
+		if err := ioutil.WriteFile(filepath.Join(dir, "Candidate.py"), []byte(source), 0644); err != nil {
+			return fmt.Errorf("Failed to create Candidate.py file: %v", err)
 		}
 	} else {
-		if err := ioutil.WriteFile(filepath.Join(dirname, "main.py"), []byte(source), 0644); err != nil {
-			return nil, fmt.Errorf("Failed to create main.py file: %v", err)
+		if err := ioutil.WriteFile(filepath.Join(dir, "main.py"), []byte(source), 0644); err != nil {
+			return fmt.Errorf("Failed to create main.py file: %v", err)
 		}
 	}
-
-	// execute the test
-	cmd := exec.Command(SandboxPath,
-		"-m", strconv.Itoa(req.MaxMB),
-		"-c", strconv.Itoa(req.MaxSeconds+1),
-		"--",
-		Python27Path, "main.py",
-	)
-	cmd.Dir = dirname
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-
-	err = cmd.Start()
-	killed := false
-
-	if err == nil {
-		// the race is on--watch for the timeout and the process completing on its own
-		timer := time.After(time.Duration(req.MaxSeconds) * time.Second)
-		terminate := make(chan bool)
-		go func() {
-			cmd.Wait()
-			terminate <- true
-		}()
-
-	waitloop:
-		for {
-			select {
-			case <-timer:
-				cmd.Process.Kill()
-				killed = true
-			case <-terminate:
-				break waitloop
-			}
-		}
-	}
-
-	message := ""
-	if err != nil {
-		message = err.Error()
-	} else if killed {
-		message = "Process exceeded its time limit"
-	} else if !cmd.ProcessState.Success() {
-		message = cmd.ProcessState.String()
-	}
-
-	result := &TestResult{
-		Error:   err != nil || !cmd.ProcessState.Success(),
-		Message: message,
-		Stdout:  stdout.String(),
-		Stderr:  stderr.String(),
-	}
-
-	return result, nil
-}
-
-func python27module_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder) {
-	python27_common_handler(w, r, decoder, true)
-}
-
-func python27stdin_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder) {
-	python27_common_handler(w, r, decoder, false)
+	return nil
 }
 
-func python27_common_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, isModule bool) {
-	request := new(Python27CommonRequest)
-	if err := decoder.Decode(request); err != nil {
-		log.Printf("Error decoding input: %v", err)
-		http.Error(w, fmt.Sprintf("Error decoding input: %v", err), http.StatusBadRequest)
-		return
-	}
-	if err := request.Validate(); err != nil {
-		log.Printf("Error validating input: %v", err)
-		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	response := &GenericResponse{
-		Report: "",
-		Passed: true,
-	}
-
-	passcount := 0
-	for n, test := range request.Tests {
-		// run it with the reference solution
-		ref, err := request.RunReferenceTest(test, request.Reference, isModule)
-		if err != nil {
-			log.Printf("Error running reference solution %d: %v", n, err)
-			http.Error(w, fmt.Sprintf("Error running reference solution %d: %v", n, err), http.StatusInternalServerError)
-			return
-		}
-
-		// run it with the candidate solution
-		cand, err := request.RunTest(test, request.Candidate, isModule)
-		if err != nil {
-			log.Printf("Error running candidate solution %d: %v", n, err)
-			http.Error(w, fmt.Sprintf("Error running candidate solution %d: %v", n, err), http.StatusInternalServerError)
-			return
-		}
-
-		// report the result
-		if n > 0 {
-			response.Report += "\n-=-=-=-=-=-=-=-=-\n\n"
-		}
-
-		// record a pass or fail
-		if ref.Error || cand.Error || ref.Stdout != cand.Stdout {
-			response.Report += fmt.Sprintf("Test #%d: FAILED\n", n+1)
-			response.Passed = false
-		} else {
-			response.Report += fmt.Sprintf("Test #%d: PASSED\n", n+1)
-			passcount++
-		}
-
-		// give a few details
-		if ref.Error {
-			response.Report += fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
-			if ref.Stdout != "" {
-				response.Report += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", ref.Stdout)
-			}
-			if ref.Stderr != "" {
-				response.Report += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", ref.Stderr)
-			}
-		}
-		if cand.Error {
-			response.Report += fmt.Sprintf("The candidate solution ended in error: %s\n", cand.Message)
-			if cand.Stdout != "" {
-				response.Report += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", cand.Stdout)
-			}
-			if cand.Stderr != "" {
-				response.Report += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", cand.Stderr)
-			}
-		}
-		if !ref.Error && !cand.Error && ref.Stdout != cand.Stdout {
-			response.Report += fmt.Sprintf("The output was incorrect.\n\n"+
-				"The correct output is:\n<<<<\n%s>>>>\n\n"+
-				"Your output was:\n<<<<\n%s>>>>\n",
-				ref.Stdout,
-				cand.Stdout)
-		}
+func (kind *pythonKind) Command(req *CommonRequest, source, test string) ([]string, string) {
+	args := []string{*kind.interpreter, "main.py"}
+	if len(kind.env) > 0 {
+		args = append(append([]string{"/usr/bin/env"}, kind.env...), args...)
 	}
-	for n, test := range request.HiddenTests {
-		// run it with the reference solution
-		ref, err := request.RunReferenceTest(test, request.Reference, isModule)
-		if err != nil {
-			log.Printf("Error running reference solution on hidden %d: %v", n, err)
-			http.Error(w, fmt.Sprintf("Error running reference solution on hidden %d: %v", n, err), http.StatusInternalServerError)
-			return
-		}
-
-		// run it with the candidate solution
-		cand, err := request.RunTest(test, request.Candidate, isModule)
-		if err != nil {
-			log.Printf("Error running candidate solution on hidden %d: %v", n, err)
-			http.Error(w, fmt.Sprintf("Error running candidate solution on hidden %d: %v", n, err), http.StatusInternalServerError)
-			return
-		}
-
-		// report the result
-		response.Report += "\n-=-=-=-=-=-=-=-=-\n\n"
-
-		// record a pass or fail
-		if ref.Error || cand.Error || ref.Stdout != cand.Stdout {
-			response.Report += fmt.Sprintf("Hidden test #%d: FAILED\n", n+1)
-			response.Passed = false
-		} else {
-			response.Report += fmt.Sprintf("Hidden test #%d: PASSED\n", n+1)
-			passcount++
-		}
-
-		// give a few details
-		if ref.Error {
-			response.Report += fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
-		}
-		if cand.Error {
-			response.Report += fmt.Sprintf("The candidate solution ended in error: %s\n", cand.Message)
-		}
-		if !ref.Error && !cand.Error && ref.Stdout != cand.Stdout {
-			response.Report += "The output was incorrect.\n"
-		}
-	}
-	tests := len(request.Tests) + len(request.HiddenTests)
-	if tests == 1 {
-		log.Printf("  passed %d/%d test", passcount, tests)
-	} else {
-		log.Printf("  passed %d/%d tests", passcount, tests)
+	if kind.isModule {
+		return args, ""
 	}
-
-	writeJson(w, r, response)
+	return args, test
 }
 
-func python27module_output_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder) {
-	python27_common_output_handler(w, r, decoder, true)
-}
-
-func python27stdin_output_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder) {
-	python27_common_output_handler(w, r, decoder, false)
-}
-
-func python27_common_output_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, isModule bool) {
-	request := new(Python27CommonRequest)
-	if err := decoder.Decode(request); err != nil {
-		log.Printf("Error decoding input: %v", err)
-		http.Error(w, fmt.Sprintf("Error decoding input: %v", err), http.StatusBadRequest)
-		return
-	}
-	if err := request.Validate(); err != nil {
-		log.Printf("Error validating input: %v", err)
-		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
-		return
-	}
-
-	results := []string{}
-
-	for n, test := range request.Tests {
-		// run it with the reference solution
-		ref, err := request.RunReferenceTest(test, request.Reference, isModule)
-		if err != nil {
-			log.Printf("Error running reference solution %d: %v", n, err)
-			http.Error(w, fmt.Sprintf("Error running reference solution %d: %v", n, err), http.StatusInternalServerError)
-			return
-		}
-
-		// give a few details
-		if ref.Error {
-			msg := fmt.Sprintf("The reference solution ended in error: %s\n", ref.Message)
-			if ref.Stdout != "" {
-				msg += fmt.Sprintf("Standard output before it quit:\n<<<<\n%s>>>>\n\n", ref.Stdout)
-			}
-			if ref.Stderr != "" {
-				msg += fmt.Sprintf("Standard error reported:\n<<<<\n%s>>>>\n\n", ref.Stderr)
-			}
-			results = append(results, msg)
-		} else {
-			results = append(results, ref.Stdout)
-		}
-	}
-
-	response := map[string][]string{"Output": results}
-
-	writeJson(w, r, response)
+func (kind *pythonKind) Compare(req *CommonRequest, ref, cand *TestResult) bool {
+	return req.CompareOutput(ref.Stdout, cand.Stdout)
 }
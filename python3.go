@@ -0,0 +1,25 @@
+package main
+
+// Python 3 problems take the same fields as their Python 2.7
+// counterparts; only the interpreter differs.
+
+var Python3ModuleDescription = &ProblemType{
+	Name:      "Python 3 Module",
+	Tag:       "python3module",
+	FieldList: Python27ModuleDescription.FieldList,
+}
+
+var Python3StdinDescription = &ProblemType{
+	Name:      "Python 3 Stdin",
+	Tag:       "python3stdin",
+	FieldList: Python27StdinDescription.FieldList,
+}
+
+// Python 3 takes the encoding of stdin and stdout from the locale,
+// which the image does not set, and would fall back to ASCII
+var python3Env = []string{"PYTHONIOENCODING=utf-8"}
+
+func init() {
+	RegisterKind(&pythonKind{description: Python3StdinDescription, interpreter: &Python3Path, env: python3Env, isModule: false})
+	RegisterKind(&pythonKind{description: Python3ModuleDescription, interpreter: &Python3Path, env: python3Env, isModule: true})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"unicode/utf8"
+)
+
+// TestStatus is the outcome of a single test in a grade response
+type TestStatus string
+
+const (
+	StatusPass           TestStatus = "pass"
+	StatusWrongAnswer    TestStatus = "wrong-answer"
+	StatusRuntimeError   TestStatus = "runtime-error"
+	StatusTimeout        TestStatus = "timeout"
+	StatusOutputLimit    TestStatus = "output-limit"
+	StatusMemoryLimit    TestStatus = "memory-limit"
+	StatusCompileError   TestStatus = "compile-error"
+	StatusReferenceError TestStatus = "reference-error"
+	StatusCheckerError   TestStatus = "checker-error"
+)
+
+// TestReport is the structured result of one test in a grade response.
+// Output is only included for public tests.
+type TestReport struct {
+	Name       string
+	Visibility string
+	Status     TestStatus
+	Verdict    Verdict
+	Weight     int
+	Message    string
+	Seconds    float64
+	Stdout     string
+	Stderr     string
+
+	// resources consumed by the candidate and reference solutions,
+	// and the time limit the candidate ran under
+	Usage            ResourceUsage
+	ReferenceUsage   ResourceUsage
+	TimeLimitSeconds float64
+
+	// for wrong answers without a checker: a unified diff of the
+	// correct output against the candidate's, and the first line of
+	// the correct output that differs (0 if the lines all match)
+	Diff            string
+	FirstDifference int
+
+	// expected files the candidate got wrong
+	FileMismatches []*FileMismatch
+}
+
+// newTestReport summarizes the candidate's run of a test. matched is
+// the overall result; outputMatched covers stdout alone.
+func newTestReport(name string, hidden bool, weight int, out *outcome, matched, outputMatched bool) *TestReport {
+	ref, cand := out.ref, out.cand
+	report := &TestReport{
+		Name:       name,
+		Visibility: "public",
+		Status:     testStatus(ref, cand, matched),
+		Verdict:    cand.Verdict,
+		Weight:     weight,
+		Message:    cand.Message,
+		Seconds:    cand.Elapsed.Seconds(),
+
+		Usage:            cand.Usage,
+		ReferenceUsage:   ref.Usage,
+		TimeLimitSeconds: cand.TimeLimit.Seconds(),
+	}
+	if report.Status == StatusReferenceError {
+		report.Message = ref.Message
+	}
+	if out.verdict != nil && out.verdict.Error {
+		report.Status = StatusCheckerError
+		report.Message = ""
+	} else if out.verdict != nil && !hidden {
+		report.Message = out.verdict.Message
+	} else if report.Status == StatusWrongAnswer && !outputMatched && !hidden {
+		report.Diff, report.FirstDifference = unifiedDiff(ref.Stdout, cand.Stdout)
+	}
+	for _, m := range out.mismatches {
+		elt := &FileMismatch{Path: m.Path, Status: m.Status}
+		if m.Status == FileDifferent && !hidden {
+			elt.Diff, elt.FirstDifference = unifiedDiff(ref.Files[m.Path], cand.Files[m.Path])
+		}
+		report.FileMismatches = append(report.FileMismatches, elt)
+	}
+	if hidden {
+		report.Visibility = "hidden"
+	} else {
+		report.Stdout = truncate(cand.Stdout, ResultOutputLimit)
+		report.Stderr = truncate(cand.Stderr, ResultOutputLimit)
+	}
+	return report
+}
+
+func testStatus(ref, cand *TestResult, matched bool) TestStatus {
+	switch {
+	case ref.Error:
+		return StatusReferenceError
+	case cand.CompileError:
+		return StatusCompileError
+	case cand.Verdict == VerdictOutputLimit:
+		return StatusOutputLimit
+	case cand.Verdict == VerdictWallTimeout || cand.Verdict == VerdictCPULimit:
+		return StatusTimeout
+	case cand.Verdict == VerdictMemoryLimit:
+		return StatusMemoryLimit
+	case cand.Error:
+		return StatusRuntimeError
+	case !matched:
+		return StatusWrongAnswer
+	}
+	return StatusPass
+}
+
+// truncate limits s to at most n bytes, cutting at a character boundary
+// and noting how much was dropped
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n[... output truncated ...]\n"
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// RunRequest runs a candidate solution on custom input, with no
+// reference solution to compare against
+type RunRequest struct {
+	Candidate string
+
+	// one run per input: stdin for stdin problems, a test driver for
+	// module problems. With no inputs, the candidate runs once on
+	// empty input.
+	Inputs []string
+
+	// optional command line arguments and environment variables for
+	// each input
+	Args [][]string
+	Env  []map[string]string
+
+	// extra files for the candidate and read-only support files
+	CandidateFiles FileSet
+	SupportFiles   FileSet
+
+	MaxSeconds  int
+	MaxMB       int
+	MaxOutputKB int
+}
+
+// Validate checks a run request and converts it to the request used to
+// build and run the candidate, along with the tests to run
+func (elt *RunRequest) Validate(kind ProblemKind) (*CommonRequest, []*testCase, error) {
+	if len(elt.Inputs) == 0 {
+		elt.Inputs = []string{""}
+	}
+	if len(elt.Args) > 0 && len(elt.Args) != len(elt.Inputs) {
+		return nil, nil, fmt.Errorf("Args must have one entry per input")
+	}
+	if len(elt.Env) > 0 && len(elt.Env) != len(elt.Inputs) {
+		return nil, nil, fmt.Errorf("Env must have one entry per input")
+	}
+	tests := []*testCase{}
+	for n, input := range elt.Inputs {
+		test := &testCase{Input: input}
+		if input != "" {
+			test.Input = fixLineEndings(input)
+		}
+		if len(elt.Args) > 0 {
+			test.Args = elt.Args[n]
+		}
+		if len(elt.Env) > 0 {
+			test.Env = elt.Env[n]
+		}
+		if err := validateArgs(test.Args, test.Env); err != nil {
+			return nil, nil, fmt.Errorf("Inputs entry %d: %v", n+1, err)
+		}
+		tests = append(tests, test)
+	}
+	req := &CommonRequest{
+		Candidate:      elt.Candidate,
+		CandidateFiles: elt.CandidateFiles,
+		SupportFiles:   elt.SupportFiles,
+		MaxSeconds:     elt.MaxSeconds,
+		MaxMB:          elt.MaxMB,
+		MaxOutputKB:    elt.MaxOutputKB,
+	}
+	if err := req.validateCandidate(kind); err != nil {
+		return nil, nil, err
+	}
+	return req, tests, nil
+}
+
+// validateCandidate checks the candidate solution, its files, and the
+// limits of a request that has no reference solution or tests
+func (elt *CommonRequest) validateCandidate(kind ProblemKind) error {
+	elt.Candidate = fixLineEndings(elt.Candidate)
+	if isEmpty(elt.Candidate) {
+		return fmt.Errorf("Candidate solution is required")
+	}
+	if err := elt.validateFiles(); err != nil {
+		return err
+	}
+	if elt.MaxSeconds < 1 {
+		return fmt.Errorf("MaxSeconds must be >= 1")
+	} else if elt.MaxSeconds > MaxSeconds {
+		return fmt.Errorf("MaxSeconds must be <= %d", MaxSeconds)
+	}
+	if elt.MaxMB < 1 {
+		return fmt.Errorf("MaxMB must be >= 1")
+	} else if elt.MaxMB > MaxMB {
+		return fmt.Errorf("MaxMB must be <= %d", MaxMB)
+	}
+	if elt.MaxOutputKB == 0 {
+		elt.MaxOutputKB = MaxOutputKB
+	} else if elt.MaxOutputKB < 1 {
+		return fmt.Errorf("MaxOutputKB must be >= 1")
+	} else if elt.MaxOutputKB > MaxOutputKB {
+		return fmt.Errorf("MaxOutputKB must be <= %d", MaxOutputKB)
+	}
+
+	// language checks are made against the reference solution, so the
+	// candidate stands in for it
+	elt.Reference = elt.Candidate
+	if err := kind.Validate(elt); err != nil {
+		return err
+	}
+	return elt.validateReservedFiles(kind)
+}
+
+// RunInputs runs the candidate solution on each test in parallel and
+// returns the results in order
+func (req *CommonRequest) RunInputs(kind ProblemKind, tests []*testCase) ([]*TestResult, error) {
+	results := make([]*TestResult, len(tests))
+	errs := make([]error, len(tests))
+	var wg sync.WaitGroup
+	for n, test := range tests {
+		wg.Add(1)
+		go func(n int, test *testCase) {
+			defer wg.Done()
+			results[n], errs[n] = req.RunTest(kind, test, req.Candidate, req.CandidateFiles, req.TimeLimit(nil))
+		}(n, test)
+	}
+	wg.Wait()
+
+	for n, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("Error running candidate solution %d: %v", n, err)
+		}
+	}
+	return results, nil
+}
+
+func run_handler(w http.ResponseWriter, r *http.Request, decoder *json.Decoder, kind ProblemKind) {
+	run := new(RunRequest)
+	if err := decoder.Decode(run); err != nil {
+		log.Printf("Error decoding input: %v", err)
+		http.Error(w, fmt.Sprintf("Error decoding input: %v", err), http.StatusBadRequest)
+		return
+	}
+	request, tests, err := run.Validate(kind)
+	if err != nil {
+		log.Printf("Error validating input: %v", err)
+		http.Error(w, fmt.Sprintf("Error validating input: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer request.Cleanup()
+
+	results, err := request.RunInputs(kind, tests)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string][]*TestResult{"Results": results}
+
+	writeJson(w, r, response)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sandboxSlots is the process-wide worker pool: every sandboxed process
+// holds a slot while it runs, across all requests
+var sandboxSlots = make(chan struct{}, runtime.NumCPU())
+
+// SetWorkers sizes the worker pool. It must be called before the
+// server starts handling requests.
+func SetWorkers(n int) {
+	sandboxSlots = make(chan struct{}, n)
+}
+
+// runSandbox executes args inside the sandbox with dir as the working
+// directory, feeding it stdinData and enforcing the given limits.
+// maxOutput is the number of bytes kept from each of stdout and stderr;
+// a process that writes more is killed.
+//
+// It waits for a slot in the worker pool first; the time limit only
+// starts once the process is launched.
+func runSandbox(dir string, args []string, stdinData string, timeLimit time.Duration, maxMB, maxOutput int) (*TestResult, error) {
+	return runSandboxIO(dir, args, strings.NewReader(stdinData), newLimitedBuffer(maxOutput), newLimitedBuffer(maxOutput), nil, timeLimit, maxMB)
+}
+
+// runSandboxIO is runSandbox with the caller supplying the process's
+// input and output buffers. Closing stop kills the process early; it
+// is then reported as timed out. Failing to start the process at all
+// is an error, not a result, so that it is never cached.
+func runSandboxIO(dir string, args []string, stdin io.Reader, stdout, stderr *limitedBuffer, stop <-chan struct{}, timeLimit time.Duration, maxMB int) (*TestResult, error) {
+	sandboxSlots <- struct{}{}
+	defer func() { <-sandboxSlots }()
+
+	// execute the test
+	cmd := sandboxCommand(dir, args, timeLimit, maxMB)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start sandbox: %v", err)
+	}
+	start := time.Now()
+	killed := false
+	overflow := false
+
+	// the race is on--watch for the timeout and the process completing on its own
+	timer := time.After(timeLimit)
+	stdoutFull, stderrFull := stdout.full, stderr.full
+	terminate := make(chan bool)
+	go func() {
+		cmd.Wait()
+		terminate <- true
+	}()
+
+	// each case fires once; a nil channel is never selected
+waitloop:
+	for {
+		select {
+		case <-timer:
+			cmd.Process.Kill()
+			killed = true
+			timer = nil
+		case <-stop:
+			cmd.Process.Kill()
+			killed = true
+			stop = nil
+		case <-stdoutFull:
+			cmd.Process.Kill()
+			overflow = true
+			stdoutFull = nil
+		case <-stderrFull:
+			cmd.Process.Kill()
+			overflow = true
+			stderrFull = nil
+		case <-terminate:
+			break waitloop
+		}
+	}
+
+	elapsed := time.Since(start)
+
+	usage := resourceUsage(cmd.ProcessState, elapsed)
+	verdict, message := classify(cmd.ProcessState, usage, stderr.String(), killed, overflow, timeLimit, maxMB)
+
+	return &TestResult{
+		Error:     verdict != VerdictOK,
+		Verdict:   verdict,
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Message:   message,
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Elapsed:   elapsed,
+		Usage:     usage,
+		TimeLimit: timeLimit,
+	}, nil
+}
+
+// sandboxCommand builds the sandbox invocation that runs args in dir.
+// The sandbox's CPU limit is a little above timeLimit so that the wall
+// clock timer normally fires first.
+func sandboxCommand(dir string, args []string, timeLimit time.Duration, maxMB int) *exec.Cmd {
+	sandboxArgs := []string{
+		"-m", strconv.Itoa(maxMB),
+		"-c", strconv.Itoa(int(math.Ceil(timeLimit.Seconds())) + 1),
+		"--",
+	}
+	cmd := exec.Command(SandboxPath, append(sandboxArgs, args...)...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// limitedBuffer collects output up to a fixed number of bytes. Anything
+// beyond that is discarded, and full is closed to signal the overflow.
+// The buffer is not embedded so that io.Copy cannot bypass Write
+// through bytes.Buffer.ReadFrom.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	exceeded bool
+	full     chan struct{}
+
+	// if set, called with each chunk of output as it is kept
+	forward func([]byte)
+}
+
+func newLimitedBuffer(limit int) *limitedBuffer {
+	return &limitedBuffer{limit: limit, full: make(chan struct{})}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		if room > 0 {
+			b.keep(p[:room])
+		}
+		if !b.exceeded {
+			b.exceeded = true
+			close(b.full)
+		}
+		return len(p), nil
+	}
+	b.keep(p)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) keep(p []byte) {
+	b.buf.Write(p)
+	if b.forward != nil {
+		b.forward(p)
+	}
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
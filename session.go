@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// An interactive session runs a candidate solution with live input and
+// output over a WebSocket. The client's first message is a JSON
+// SessionRequest. Every later message is fed to the program's stdin as
+// it arrives, and an empty message closes stdin. The server sends
+// SessionMessages: output as the program writes it, then the final
+// result or an error, and closes the connection.
+
+// SessionRequest describes an interactive session
+type SessionRequest struct {
+	Candidate string
+
+	// the test driver for module problems; for stdin problems, input
+	// fed to the program before anything the client sends
+	Test string
+
+	// optional command line arguments and environment variables
+	Args []string
+	Env  map[string]string
+
+	// extra files for the candidate and read-only support files
+	CandidateFiles FileSet
+	SupportFiles   FileSet
+
+	MaxSeconds int
+	MaxMB      int
+}
+
+// SessionMessage is a message from the server during a session
+type SessionMessage struct {
+	Stdout string      `json:",omitempty"`
+	Stderr string      `json:",omitempty"`
+	Result *TestResult `json:",omitempty"`
+	Error  string      `json:",omitempty"`
+}
+
+// Validate checks a session request and converts it to the request
+// used to build and run the candidate
+func (s *SessionRequest) Validate(kind ProblemKind) (*CommonRequest, error) {
+	if s.Test != "" {
+		s.Test = fixLineEndings(s.Test)
+	}
+	if err := validateArgs(s.Args, s.Env); err != nil {
+		return nil, err
+	}
+	req := &CommonRequest{
+		Candidate:      s.Candidate,
+		CandidateFiles: s.CandidateFiles,
+		SupportFiles:   s.SupportFiles,
+		MaxSeconds:     s.MaxSeconds,
+		MaxMB:          s.MaxMB,
+	}
+	if err := req.validateCandidate(kind); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// sessionHandler serves interactive sessions for one problem kind
+func sessionHandler(kind ProblemKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		start := time.Now()
+		ws := upgradeWebSocket(w, r)
+		if ws == nil {
+			return
+		}
+		defer ws.Close(wsNormalClosure, "")
+
+		// the first message describes the session
+		ws.conn.SetReadDeadline(time.Now().Add(SessionIdleTimeout))
+		_, raw, err := ws.ReadMessage()
+		if err != nil {
+			log.Printf("Error reading session request: %v", err)
+			return
+		}
+		ws.conn.SetReadDeadline(time.Time{})
+
+		session := new(SessionRequest)
+		if err := json.Unmarshal(raw, session); err != nil {
+			log.Printf("Error decoding input: %v", err)
+			ws.WriteJSON(&SessionMessage{Error: fmt.Sprintf("Error decoding input: %v", err)})
+			ws.Close(wsPolicyViolation, "invalid session request")
+			return
+		}
+		request, err := session.Validate(kind)
+		if err != nil {
+			log.Printf("Error validating input: %v", err)
+			ws.WriteJSON(&SessionMessage{Error: fmt.Sprintf("Error validating input: %v", err)})
+			ws.Close(wsPolicyViolation, "invalid session request")
+			return
+		}
+
+		test := &testCase{Input: session.Test, Args: session.Args, Env: session.Env}
+		result, err := request.RunSession(kind, test, ws)
+		if err != nil {
+			log.Printf("%v", err)
+			ws.WriteJSON(&SessionMessage{Error: err.Error()})
+			return
+		}
+		ws.WriteJSON(&SessionMessage{Result: result})
+		log.Printf("  session completed in %v", time.Since(start))
+	}
+}
+
+// RunSession runs the candidate solution on a test, feeding it messages
+// from the client and forwarding its output as it is written. The run
+// is limited to MaxSeconds, and it is stopped early if neither side
+// has sent anything for SessionIdleTimeout or if the client goes away.
+func (req *CommonRequest) RunSession(kind ProblemKind, test *testCase, ws *wsConn) (*TestResult, error) {
+	defer req.Cleanup()
+
+	run, failed, err := req.setup(kind, test, req.Candidate, req.CandidateFiles)
+	if err != nil || failed != nil {
+		return failed, err
+	}
+	defer os.RemoveAll(run.dir)
+
+	// the process reads stdin straight from a pipe, so it sees input
+	// as soon as it arrives
+	stdinRead, stdinWrite, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create stdin pipe: %v", err)
+	}
+	defer stdinRead.Close()
+	defer stdinWrite.Close()
+
+	var lastActive int64
+	touch := func() {
+		atomic.StoreInt64(&lastActive, time.Now().UnixNano())
+	}
+	touch()
+
+	// stop kills the process early; reason says why
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var reason string
+	halt := func(why string) {
+		stopOnce.Do(func() {
+			reason = why
+			close(stop)
+		})
+	}
+	done := make(chan struct{})
+	defer close(done)
+
+	// feed stdin until the client closes it or goes away
+	go func() {
+		if _, err := io.WriteString(stdinWrite, run.stdin); err != nil {
+			return
+		}
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				halt("The client disconnected")
+				return
+			}
+			touch()
+			if len(data) == 0 {
+				stdinWrite.Close()
+				continue
+			}
+			// a program that has closed stdin simply misses the input
+			stdinWrite.Write(data)
+		}
+	}()
+
+	// watch for an idle session
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if time.Since(time.Unix(0, atomic.LoadInt64(&lastActive))) > SessionIdleTimeout {
+					halt(fmt.Sprintf("The session was idle for more than %v", SessionIdleTimeout))
+					return
+				}
+			}
+		}
+	}()
+
+	stdout := newLimitedBuffer(req.MaxOutputKB * 1024)
+	stdout.forward = forwardOutput(ws, touch, func(s string) *SessionMessage { return &SessionMessage{Stdout: s} })
+	stderr := newLimitedBuffer(req.MaxOutputKB * 1024)
+	stderr.forward = forwardOutput(ws, touch, func(s string) *SessionMessage { return &SessionMessage{Stderr: s} })
+
+	timeLimit := time.Duration(req.MaxSeconds) * time.Second
+	result, err := runSandboxIO(run.dir, run.args, stdinRead, stdout, stderr, stop, timeLimit, run.maxMB)
+	if err != nil {
+		return nil, err
+	}
+
+	// runSandboxIO reports a stopped process as timed out; say why
+	select {
+	case <-stop:
+		if result.Verdict.TimedOut() {
+			result.Message = reason
+		}
+	default:
+	}
+	return result, nil
+}
+
+// forwardOutput returns a limitedBuffer hook that sends output to the
+// client. An incomplete UTF-8 character at the end of a chunk is held
+// back until the rest of it arrives.
+func forwardOutput(ws *wsConn, touch func(), message func(string) *SessionMessage) func([]byte) {
+	var pending []byte
+	return func(p []byte) {
+		touch()
+		data := append(pending, p...)
+		cut := len(data)
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					cut = i
+				}
+				break
+			}
+		}
+		pending = append([]byte(nil), data[cut:]...)
+		if cut > 0 {
+			ws.WriteJSON(message(string(data[:cut])))
+		}
+	}
+}
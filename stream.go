@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TestEvent reports one finished test to a streaming client. Tests
+// finish in any order; Index is the test's position in the final
+// Results list. Details are only included for public tests.
+type TestEvent struct {
+	Index  int
+	Name   string
+	Hidden bool
+	Passed bool
+	Result *TestReport `json:",omitempty"`
+}
+
+// streamHandler grades a request like grade_handler, but answers with
+// a stream of Server-Sent Events: a "test" event carrying a TestEvent
+// as each test finishes, then a "summary" event carrying the
+// GenericResponse, or an "error" event if grading failed.
+func streamHandler(kind ProblemKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		start := time.Now()
+		if !checkJSONRequest(w, r, "text/event-stream") {
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			log.Printf("Response writer does not support streaming")
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		defer r.Body.Close()
+		request := decodeRequest(w, decoder, kind)
+		if request == nil {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// tests report from their own goroutines
+		var mutex sync.Mutex
+		send := func(event string, elt interface{}) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err := writeEvent(w, event, elt); err != nil {
+				log.Printf("Error writing %s event: %v", event, err)
+				return
+			}
+			flusher.Flush()
+		}
+
+		response, err := request.Grade(kind, func(n int, report *TestReport) {
+			event := &TestEvent{
+				Index:  n,
+				Name:   report.Name,
+				Hidden: report.Visibility == "hidden",
+				Passed: report.Status == StatusPass,
+			}
+			if !event.Hidden {
+				event.Result = report
+			}
+			send("test", event)
+		})
+		if err != nil {
+			log.Printf("%v", err)
+			send("error", map[string]string{"Error": err.Error()})
+		} else {
+			send("summary", response)
+		}
+		log.Printf("  request completed in %v", time.Since(start))
+	}
+}
+
+// writeEvent writes one Server-Sent Event with elt encoded as JSON.
+// The encoding has no raw newlines, so it fits on a single data line.
+func writeEvent(w http.ResponseWriter, event string, elt interface{}) error {
+	raw, err := json.Marshal(elt)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, raw)
+	return err
+}
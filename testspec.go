@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TestSpec is one entry in Tests or HiddenTests. In JSON it is either a
+// string, which is the test's input, or an object. Fields left out of
+// an object fall back to the request's per-test lists and defaults.
+type TestSpec struct {
+	// shown in reports in place of "Test #n"
+	Name string
+
+	// stdin or a test driver, depending on the kind
+	Input string
+
+	Args []string
+	Env  map[string]string
+
+	// if set, the output the candidate must produce; the reference
+	// solution is not run on this test, and expected files are not
+	// compared
+	Expected *string
+
+	Weight *int
+
+	// if set, the candidate's time limit in seconds on this test,
+	// replacing MaxSeconds and TimeMultiplier
+	Timeout float64
+
+	// only allowed in HiddenTests, since students can see Tests
+	Hidden bool
+
+	// given as a plain string
+	plain bool
+}
+
+func (spec *TestSpec) UnmarshalJSON(raw []byte) error {
+	var input string
+	if err := json.Unmarshal(raw, &input); err == nil {
+		*spec = TestSpec{Input: input, plain: true}
+		return nil
+	}
+	if len(raw) == 0 || raw[0] != '{' {
+		return fmt.Errorf("each test must be a string or an object")
+	}
+	type object TestSpec
+	return json.Unmarshal(raw, (*object)(spec))
+}
+
+// expectedOutput normalizes pinned output the way test input is, but
+// keeps trailing spaces, which exact comparison relies on
+func expectedOutput(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// pinnedResult stands in for the reference run of a test with
+// Expected output
+func pinnedResult(expected string) *TestResult {
+	return &TestResult{Verdict: VerdictOK, Stdout: expected}
+}
+
+// testFields describes the object form of a test for ProblemField
+// metadata. inputType is the type of the Input field. The entries
+// share the access settings of the field that holds them.
+func testFields(inputType string) []ProblemField {
+	return []ProblemField{
+		{
+			Name:   "Name",
+			Prompt: "Test name",
+			Title:  "Name shown in reports instead of the test number",
+			Type:   "text",
+		},
+		{
+			Name:   "Input",
+			Prompt: "Test input",
+			Title:  "The test itself, as given when a test is a plain string",
+			Type:   inputType,
+		},
+		{
+			Name:   "Args",
+			Prompt: "Test arguments",
+			Title:  "Command line arguments given to the solution",
+			Type:   "args",
+		},
+		{
+			Name:   "Env",
+			Prompt: "Test environment",
+			Title:  "Environment variables set for the solution",
+			Type:   "env",
+		},
+		{
+			Name:   "Expected",
+			Prompt: "Expected output",
+			Title:  "If set, the output required instead of running the reference solution",
+			Type:   "text",
+		},
+		{
+			Name:    "Weight",
+			Prompt:  "Test weight",
+			Title:   "Points awarded for passing the test",
+			Type:    "int",
+			Default: "1",
+		},
+		{
+			Name:   "Timeout",
+			Prompt: "Test time limit in seconds",
+			Title:  "If set, the time permitted on this test, in place of MaxSeconds and TimeMultiplier",
+			Type:   "float",
+		},
+		{
+			Name:    "Hidden",
+			Prompt:  "Hidden test?",
+			Title:   "Whether the test is hidden from students; hidden tests belong in HiddenTests",
+			Type:    "bool",
+			Default: "false",
+		},
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Verdict classifies how a sandboxed process ended
+type Verdict string
+
+const (
+	VerdictOK          Verdict = "ok"
+	VerdictNonzeroExit Verdict = "nonzero-exit"
+	VerdictSegfault    Verdict = "segfault"
+	VerdictSignal      Verdict = "signal"
+	VerdictMemoryLimit Verdict = "memory-limit"
+	VerdictCPULimit    Verdict = "cpu-limit"
+	VerdictWallTimeout Verdict = "wall-timeout"
+	VerdictOutputLimit Verdict = "output-limit"
+)
+
+// TimedOut reports whether a process was stopped for running too long
+func (v Verdict) TimedOut() bool {
+	return v == VerdictWallTimeout || v == VerdictCPULimit
+}
+
+// messages that runtimes print when they run out of memory
+var outOfMemoryMessages = []string{
+	"MemoryError",
+	"java.lang.OutOfMemoryError",
+	"std::bad_alloc",
+	"runtime: out of memory",
+	"Cannot allocate memory",
+}
+
+// a process whose peak resident size comes within this fraction of
+// the limit is assumed to have died for lack of memory
+const memoryLimitFraction = 0.9
+
+// classify decides why a sandboxed process ended and describes it for
+// the student. The sandbox may pass a signal through either as its own
+// death or, like a shell, as an exit status of 128 plus the signal.
+func classify(state *os.ProcessState, usage ResourceUsage, stderr string, killed, overflow bool, timeLimit time.Duration, maxMB int) (Verdict, string) {
+	switch {
+	case overflow:
+		return VerdictOutputLimit, "Process exceeded its output limit"
+	case killed:
+		return VerdictWallTimeout, "Process exceeded its time limit"
+	case state.Success():
+		return VerdictOK, ""
+	}
+
+	var signal syscall.Signal
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if ok && status.Signaled() {
+		signal = status.Signal()
+	} else if code := state.ExitCode(); code > 128 && code < 128+65 {
+		signal = syscall.Signal(code - 128)
+	}
+
+	cpu := state.UserTime() + state.SystemTime()
+	outOfMemory := float64(usage.MaxRSSKB) >= memoryLimitFraction*float64(maxMB*1024)
+	for _, msg := range outOfMemoryMessages {
+		if strings.Contains(stderr, msg) {
+			outOfMemory = true
+		}
+	}
+
+	switch {
+	case signal == syscall.SIGXCPU || (signal == syscall.SIGKILL && cpu >= timeLimit):
+		return VerdictCPULimit, "Process exceeded its CPU time limit"
+	case outOfMemory:
+		return VerdictMemoryLimit, "Process exceeded its memory limit"
+	case signal == syscall.SIGSEGV || signal == syscall.SIGBUS:
+		return VerdictSegfault, fmt.Sprintf("Process crashed: %v", signal)
+	case signal != 0:
+		return VerdictSignal, fmt.Sprintf("Process was killed by signal: %v", signal)
+	}
+	return VerdictNonzeroExit, fmt.Sprintf("Process exited with status %d", state.ExitCode())
+}
+
+// ResourceUsage records what a sandboxed process consumed
+type ResourceUsage struct {
+	UserSeconds   float64
+	SystemSeconds float64
+	WallSeconds   float64
+	MaxRSSKB      int64
+}
+
+func resourceUsage(state *os.ProcessState, elapsed time.Duration) ResourceUsage {
+	usage := ResourceUsage{
+		UserSeconds:   state.UserTime().Seconds(),
+		SystemSeconds: state.SystemTime().Seconds(),
+		WallSeconds:   elapsed.Seconds(),
+	}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// kilobytes on Linux
+		usage.MaxRSSKB = int64(rusage.Maxrss)
+	}
+	return usage
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a minimal server side of the WebSocket protocol (RFC 6455), enough
+// for the interactive session endpoint
+
+// message opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// close status codes
+const (
+	wsNormalClosure   = 1000
+	wsProtocolError   = 1002
+	wsPolicyViolation = 1008
+	wsMessageTooBig   = 1009
+)
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsConn is an upgraded WebSocket connection. Messages may be written
+// from several goroutines; only one goroutine may read.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+
+	writeMutex sync.Mutex
+	closed     bool
+}
+
+// hosts other than the service's own whose pages may open WebSockets;
+// set by main
+var allowedOrigins hostList
+
+// checkOrigin guards against cross-site WebSocket requests, which
+// browsers make without a CORS preflight. Clients other than browsers
+// send no Origin and are allowed.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || allowedOrigins.Allows(u)
+}
+
+// upgradeWebSocket performs the opening handshake. On failure it
+// reports the error to the client and returns nil.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) *wsConn {
+	if r.Method != "GET" {
+		log.Printf("WebSocket request called with method %s", r.Method)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		log.Printf("WebSocket request is not an upgrade")
+		http.Error(w, "Request must be a WebSocket upgrade", http.StatusBadRequest)
+		return nil
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		log.Printf("Unsupported WebSocket version %s", r.Header.Get("Sec-WebSocket-Version"))
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil
+	}
+	if !checkOrigin(r) {
+		log.Printf("WebSocket request from disallowed origin %s", r.Header.Get("Origin"))
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return nil
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		log.Printf("WebSocket request is missing its key")
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		log.Printf("Response writer does not support hijacking")
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Error hijacking connection: %v", err)
+		http.Error(w, "WebSockets are not supported", http.StatusInternalServerError)
+		return nil
+	}
+
+	h := sha1.New()
+	io.WriteString(h, key+wsGUID)
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		log.Printf("Error completing WebSocket handshake: %v", err)
+		conn.Close()
+		return nil
+	}
+	return &wsConn{conn: conn, rw: rw}
+}
+
+// headerHasToken reports whether a comma-separated header contains token
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, elt := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(elt), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsError is a protocol violation by the client, closed with code
+type wsError struct {
+	code   int
+	reason string
+}
+
+func (e *wsError) Error() string {
+	return e.reason
+}
+
+// ReadMessage returns the next data message, reassembling fragments and
+// answering pings along the way. It returns io.EOF once the client
+// closes the connection.
+func (ws *wsConn) ReadMessage() (opcode int, data []byte, err error) {
+	opcode = -1
+	for {
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			if e, ok := err.(*wsError); ok {
+				ws.Close(e.code, e.reason)
+			}
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.Close(wsNormalClosure, "")
+			return 0, nil, io.EOF
+		case wsText, wsBinary:
+			if opcode != -1 {
+				ws.Close(wsProtocolError, "expected a continuation frame")
+				return 0, nil, fmt.Errorf("WebSocket message interrupted by a new message")
+			}
+			opcode = op
+		case wsContinuation:
+			if opcode == -1 {
+				ws.Close(wsProtocolError, "unexpected continuation frame")
+				return 0, nil, fmt.Errorf("WebSocket continuation without a message")
+			}
+		default:
+			ws.Close(wsProtocolError, "unknown opcode")
+			return 0, nil, fmt.Errorf("WebSocket frame has unknown opcode %d", op)
+		}
+
+		if len(data)+len(payload) > WebSocketMaxMessage {
+			ws.Close(wsMessageTooBig, "message too big")
+			return 0, nil, fmt.Errorf("WebSocket message exceeds %d bytes", WebSocketMaxMessage)
+		}
+		data = append(data, payload...)
+		if fin {
+			return opcode, data, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks a single frame
+func (ws *wsConn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.rw, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsError{wsProtocolError, "reserved bits set"}
+	}
+	opcode = int(header[0] & 0x0F)
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsError{wsProtocolError, "client frames must be masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, &wsError{wsProtocolError, "invalid control frame"}
+	}
+	if length > WebSocketMaxMessage {
+		return false, 0, nil, &wsError{wsMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single unfragmented frame
+func (ws *wsConn) writeFrame(opcode int, payload []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	if ws.closed {
+		return fmt.Errorf("WebSocket connection is closed")
+	}
+
+	header := []byte{0x80 | byte(opcode)}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+
+	ws.conn.SetWriteDeadline(time.Now().Add(WebSocketWriteTimeout))
+	ws.rw.Write(header)
+	ws.rw.Write(payload)
+	return ws.rw.Flush()
+}
+
+// WriteJSON sends elt as a text message
+func (ws *wsConn) WriteJSON(elt interface{}) error {
+	raw, err := json.Marshal(elt)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(wsText, raw)
+}
+
+// Close sends a close frame with the given status and closes the
+// connection. It is safe to call more than once.
+func (ws *wsConn) Close(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	ws.writeFrame(wsClose, payload)
+
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	if !ws.closed {
+		ws.closed = true
+		ws.conn.Close()
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// wsPair connects a server-side wsConn to a plain client connection
+func wsPair(t *testing.T) (*wsConn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server))
+	return &wsConn{conn: server, rw: rw}, client
+}
+
+// clientFrame encodes a frame as a client would send it
+func clientFrame(fin bool, opcode int, payload string, masked bool) []byte {
+	var buf bytes.Buffer
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	buf.WriteByte(first)
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		buf.WriteByte(maskBit | byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		buf.WriteByte(maskBit | 126)
+		binary.Write(&buf, binary.BigEndian, uint16(len(payload)))
+	default:
+		buf.WriteByte(maskBit | 127)
+		binary.Write(&buf, binary.BigEndian, uint64(len(payload)))
+	}
+	if !masked {
+		buf.WriteString(payload)
+		return buf.Bytes()
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	buf.Write(mask)
+	for i := 0; i < len(payload); i++ {
+		buf.WriteByte(payload[i] ^ mask[i%4])
+	}
+	return buf.Bytes()
+}
+
+type serverFrame struct {
+	opcode  int
+	payload []byte
+}
+
+// parseServerFrames decodes the unmasked frames a server sent
+func parseServerFrames(t *testing.T, raw []byte) []serverFrame {
+	var frames []serverFrame
+	r := bytes.NewReader(raw)
+	for r.Len() > 0 {
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			t.Fatalf("truncated frame header: %v", err)
+		}
+		if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+			t.Fatalf("server frame must be final and unmasked: % x", header)
+		}
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext uint16
+			binary.Read(r, binary.BigEndian, &ext)
+			length = uint64(ext)
+		case 127:
+			binary.Read(r, binary.BigEndian, &length)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			t.Fatalf("truncated frame payload: %v", err)
+		}
+		frames = append(frames, serverFrame{int(header[0] & 0x0F), payload})
+	}
+	return frames
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	tooBig := []byte{0x80 | wsBinary, 0x80 | 127, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(tooBig[2:], WebSocketMaxMessage+1)
+
+	tests := []struct {
+		name   string
+		input  [][]byte
+		opcode int
+		data   string
+		err    bool
+
+		// the server's replies: pong payloads and the close status
+		pongs     []string
+		closeCode int
+	}{
+		{
+			name:   "text",
+			input:  [][]byte{clientFrame(true, wsText, "hello", true)},
+			opcode: wsText,
+			data:   "hello",
+		},
+		{
+			name:   "empty",
+			input:  [][]byte{clientFrame(true, wsBinary, "", true)},
+			opcode: wsBinary,
+			data:   "",
+		},
+		{
+			name:   "extended length",
+			input:  [][]byte{clientFrame(true, wsText, string(bytes.Repeat([]byte("x"), 300)), true)},
+			opcode: wsText,
+			data:   string(bytes.Repeat([]byte("x"), 300)),
+		},
+		{
+			name: "fragmented with ping",
+			input: [][]byte{
+				clientFrame(false, wsText, "hel", true),
+				clientFrame(true, wsPing, "p", true),
+				clientFrame(true, wsPong, "ignored", true),
+				clientFrame(true, wsContinuation, "lo", true),
+			},
+			opcode: wsText,
+			data:   "hello",
+			pongs:  []string{"p"},
+		},
+		{
+			name:      "close",
+			input:     [][]byte{clientFrame(true, wsClose, "\x03\xe8", true)},
+			err:       true,
+			closeCode: wsNormalClosure,
+		},
+		{
+			name:      "unmasked",
+			input:     [][]byte{clientFrame(true, wsText, "hello", false)},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			input:     [][]byte{{0x80 | 0x40 | wsText, 0x80}},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name:      "continuation without message",
+			input:     [][]byte{clientFrame(true, wsContinuation, "lo", true)},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name: "interrupted message",
+			input: [][]byte{
+				clientFrame(false, wsText, "hel", true),
+				clientFrame(true, wsText, "lo", true),
+			},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name:      "fragmented control frame",
+			input:     [][]byte{clientFrame(false, wsPing, "p", true)},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			input:     [][]byte{clientFrame(true, 0x3, "", true)},
+			err:       true,
+			closeCode: wsProtocolError,
+		},
+		{
+			name:      "too big",
+			input:     [][]byte{tooBig},
+			err:       true,
+			closeCode: wsMessageTooBig,
+		},
+	}
+	for _, test := range tests {
+		ws, client := wsPair(t)
+		go func(input [][]byte) {
+			for _, frame := range input {
+				client.Write(frame)
+			}
+		}(test.input)
+
+		opcode, data, err := ws.ReadMessage()
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: ReadMessage succeeded, want an error", test.name)
+			}
+		} else if err != nil || opcode != test.opcode || string(data) != test.data {
+			t.Errorf("%s: ReadMessage = %d, %q, %v, want %d, %q", test.name, opcode, data, err, test.opcode, test.data)
+		}
+
+		ws.conn.Close()
+		raw, _ := ioutil.ReadAll(client)
+		client.Close()
+		var pongs []string
+		closeCode := 0
+		for _, frame := range parseServerFrames(t, raw) {
+			switch frame.opcode {
+			case wsPong:
+				pongs = append(pongs, string(frame.payload))
+			case wsClose:
+				closeCode = int(binary.BigEndian.Uint16(frame.payload))
+			default:
+				t.Errorf("%s: unexpected server frame with opcode %d", test.name, frame.opcode)
+			}
+		}
+		if strings.Join(pongs, ",") != strings.Join(test.pongs, ",") {
+			t.Errorf("%s: server sent pongs %q, want %q", test.name, pongs, test.pongs)
+		}
+		if closeCode != test.closeCode {
+			t.Errorf("%s: server closed with %d, want %d", test.name, closeCode, test.closeCode)
+		}
+	}
+}
+
+func TestWebSocketWriteFrame(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		ws, client := wsPair(t)
+		payload := bytes.Repeat([]byte{'z'}, size)
+		go func(ws *wsConn, payload []byte) {
+			ws.writeFrame(wsBinary, payload)
+			ws.conn.Close()
+		}(ws, payload)
+		raw, _ := ioutil.ReadAll(client)
+		client.Close()
+
+		frames := parseServerFrames(t, raw)
+		if len(frames) != 1 || frames[0].opcode != wsBinary || !bytes.Equal(frames[0].payload, payload) {
+			t.Errorf("writeFrame with %d bytes did not round trip", size)
+		}
+
+		// the shortest length encoding must be used
+		want := byte(size)
+		if size > 0xFFFF {
+			want = 127
+		} else if size >= 126 {
+			want = 126
+		}
+		if len(raw) >= 2 && raw[1] != want {
+			t.Errorf("writeFrame with %d bytes used length byte %d, want %d", size, raw[1], want)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	allowedOrigins = parseHostList("lms.example.edu, Other.example.edu:8443")
+	defer func() { allowedOrigins = nil }()
+
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"http://sandbox.example.edu:8081", true},
+		{"https://lms.example.edu", true},
+		{"https://LMS.example.edu:444", true},
+		{"https://other.example.edu:8443", true},
+		{"https://other.example.edu", false},
+		{"https://evil.example.com", false},
+		{"http://sandbox.example.edu", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		r := &http.Request{Host: "sandbox.example.edu:8081", Header: http.Header{}}
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if got := checkOrigin(r); got != test.ok {
+			t.Errorf("checkOrigin(%q) = %v, want %v", test.origin, got, test.ok)
+		}
+	}
+}